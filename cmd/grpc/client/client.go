@@ -1,66 +1,100 @@
+// Command client is a command line client of the gRPC services.
+//
+//	client user create|get|list|delete [flags]
+//	client order create|get|cancel|watch [flags]
+//	client health [flags]
+//	client demo [flags]
+//
+// Replies are printed as a table, JSON or YAML (-o), request bodies can be
+// read from a JSON file or stdin (-f), and the exit code tells the gRPC
+// status of a failed call apart, see exit.go.
 package main
 
 import (
-	"context"
-	"log"
-	"time"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+// commands maps the verbs of a resource to their implementation.
+type commands map[string]func(args []string) error
 
-	orderpb "go-learning/pkg/grpc/order"
-	userpb "go-learning/pkg/grpc/user"
-)
+func (c commands) verbs() string {
+	verbs := make([]string, 0, len(c))
+	for verb := range c {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	return strings.Join(verbs, "|")
+}
 
 func main() {
-	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return exitUsage
+	}
+
+	var cmd func(args []string) error
+	resource, args := args[0], args[1:]
+	switch resource {
+	case "user", "order":
+		group := userCommands
+		if resource == "order" {
+			group = orderCommands
+		}
+		if len(args) == 0 || group[args[0]] == nil {
+			fmt.Fprintf(os.Stderr, "Usage: client %s %s [flags]\n", resource, group.verbs())
+			return exitUsage
+		}
+		cmd, args = group[args[0]], args[1:]
+	case "health":
+		cmd = runHealth
+	case "demo":
+		cmd = runDemo
+	case "help", "-h", "-help", "--help":
+		usage()
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", resource)
+		usage()
+		return exitUsage
 	}
-	defer conn.Close()
+	return exit(os.Stderr, cmd(args))
+}
 
-	// Create clients
-	userClient := userpb.NewUserServiceClient(conn)
-	orderClient := orderpb.NewOrderServiceClient(conn)
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: client <command> [flags]
 
-	// Context purpose is to prevent:
-	// - Resource leaks
-	// - Orphaned operations
-	// - Cascading delays
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+Commands:
+  user %s
+  order %s
+  health    check the health of the server or of a service
+  demo      call every RPC once
 
-	// Create a user
-	createUserResp, err := userClient.CreateUser(ctx, &userpb.CreateUserRequest{
-		Name:  "Jorge",
-		Email: "jorge@example.com",
-	})
-	if err != nil {
-		log.Fatalf("CreateUser failed: %v", err)
-	}
-	log.Printf("Created User: ID=%s, Status=%s", createUserResp.GetId(), createUserResp.GetStatus().GetMessage())
+Run "client <command> <verb> -h" for the flags of a command.
+`, userCommands.verbs(), orderCommands.verbs())
+}
 
-	// Fetch the user
-	userResp, err := userClient.GetUser(ctx, &userpb.GetUserRequest{Id: createUserResp.GetId()})
+// parseID parses the flags of a command taking a single id argument.
+func parseID(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parse(fs, args)
 	if err != nil {
-		log.Fatalf("GetUser failed: %v", err)
+		return "", err
 	}
-	log.Printf("Fetched User: %s (%s)", userResp.GetName(), userResp.GetEmail())
-
-	// Create an order
-	createOrderResp, err := orderClient.CreateOrder(ctx, &orderpb.CreateOrderRequest{
-		UserId:     createUserResp.GetId(),
-		ProductIds: []string{"p1", "p2", "p3"},
-	})
-	if err != nil {
-		log.Fatalf("CreateOrder failed: %v", err)
+	if len(positional) != 1 || positional[0] == "" {
+		return "", usageErrorf(fs, "expected a single id, got %d arguments", len(positional))
 	}
-	log.Printf("Created Order: ID=%s, Status=%s", createOrderResp.GetId(), createOrderResp.GetStatus().GetMessage())
+	return positional[0], nil
+}
 
-	// Fetch the order
-	orderResp, err := orderClient.GetOrder(ctx, &orderpb.GetOrderRequest{Id: createOrderResp.GetId()})
-	if err != nil {
-		log.Fatalf("GetOrder failed: %v", err)
-	}
-	log.Printf("Fetched Order: %s, Amount=%.2f, Products=%v", orderResp.GetId(), orderResp.GetAmount(), orderResp.GetProductIds())
+// printNextPage tells how to fetch the next page, on stderr so the table
+// stays easy to process.
+func printNextPage(token string) {
+	fmt.Fprintf(os.Stderr, "more results: -page-token %s\n", token)
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
+	"go-learning/pkg/id"
+)
+
+// runDemo walks through every RPC, the way a new client would use them.
+//
+//	client demo -addr localhost:50051
+func runDemo(args []string) error {
+	fs, opts := newFlagSet("demo", "")
+	if _, err := parse(fs, args); err != nil {
+		return err
+	}
+
+	conn, err := opts.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Context purpose is to prevent:
+	// - Resource leaks
+	// - Orphaned operations
+	// - Cascading delays
+	ctx, cancel, err := opts.context(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	// Create clients
+	userClient := userpb.NewUserServiceClient(conn)
+	orderClient := orderpb.NewOrderServiceClient(conn)
+	productClient := productpb.NewProductServiceClient(conn)
+
+	// Create a user
+	createUserResp, err := userClient.CreateUser(ctx, &userpb.CreateUserRequest{
+		Name:  "Jorge",
+		Email: "jorge@example.com",
+	})
+	if err != nil {
+		log.Fatalf("CreateUser failed: %v", err)
+	}
+	log.Printf("Created User: ID=%s, Status=%s", createUserResp.GetId(), createUserResp.GetStatus().GetMessage())
+
+	// Fetch the user
+	userResp, err := userClient.GetUser(ctx, &userpb.GetUserRequest{Id: createUserResp.GetId()})
+	if err != nil {
+		log.Fatalf("GetUser failed: %v", err)
+	}
+	log.Printf("Fetched User: %s (%s)", userResp.GetName(), userResp.GetEmail())
+
+	// Update only the email of the user
+	updateUserResp, err := userClient.UpdateUser(ctx, &userpb.UpdateUserRequest{
+		Id:         createUserResp.GetId(),
+		Email:      "jorge@example.org",
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+	})
+	if err != nil {
+		log.Fatalf("UpdateUser failed: %v", err)
+	}
+	log.Printf("Updated User: %s (%s)", updateUserResp.GetName(), updateUserResp.GetEmail())
+
+	// Create a second user to delete it right away
+	tmpUserResp, err := userClient.CreateUser(ctx, &userpb.CreateUserRequest{
+		Name:  "Temporary",
+		Email: "tmp@example.com",
+	})
+	if err != nil {
+		log.Fatalf("CreateUser failed: %v", err)
+	}
+	deleteUserResp, err := userClient.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: tmpUserResp.GetId()})
+	if err != nil {
+		log.Fatalf("DeleteUser failed: %v", err)
+	}
+	log.Printf("Deleted User: ID=%s, Status=%s", tmpUserResp.GetId(), deleteUserResp.GetStatus().GetMessage())
+
+	// List all users, one page at a time
+	pageToken := ""
+	for {
+		listUsersResp, err := userClient.ListUsers(ctx, &userpb.ListUsersRequest{PageSize: 10, PageToken: pageToken})
+		if err != nil {
+			log.Fatalf("ListUsers failed: %v", err)
+		}
+		for _, u := range listUsersResp.GetUsers() {
+			log.Printf("Listed User: %s %s (%s)", u.GetId(), u.GetName(), u.GetEmail())
+		}
+		if pageToken = listUsersResp.GetNextPageToken(); pageToken == "" {
+			break
+		}
+	}
+
+	// Fetch a user that doesn't exist, the server answers with NotFound
+	_, err = userClient.GetUser(ctx, &userpb.GetUserRequest{Id: id.New(id.User)})
+	switch status.Code(err) {
+	case codes.NotFound:
+		logStatus("GetUser missing user", err)
+	case codes.OK:
+		log.Fatalf("GetUser: expected NotFound for a missing user")
+	default:
+		log.Fatalf("GetUser failed: %v", err)
+	}
+
+	// Create an invalid order, every invalid field is reported
+	_, err = orderClient.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId:     createUserResp.GetId(),
+		ProductIds: []string{"p1", "p1", ""},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		log.Fatalf("CreateOrder: expected InvalidArgument, got %v", err)
+	}
+	logStatus("CreateOrder rejected as expected", err)
+
+	// Create the products of the catalog, orders are priced from it
+	var productIDs []string
+	for _, p := range []*productpb.CreateProductRequest{
+		{Sku: "KB-001", Name: "Keyboard", Price: &common.Money{Amount: 4999, Currency: "USD"}, Stock: 10},
+		{Sku: "MS-001", Name: "Mouse", Price: &common.Money{Amount: 1999, Currency: "USD"}, Stock: 10},
+	} {
+		createProductResp, err := productClient.CreateProduct(ctx, p)
+		if err != nil {
+			log.Fatalf("CreateProduct failed: %v", err)
+		}
+		productIDs = append(productIDs, createProductResp.GetId())
+		log.Printf("Created Product: ID=%s, SKU=%s", createProductResp.GetId(), p.GetSku())
+	}
+
+	// Create an order
+	createOrderResp, err := orderClient.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId: createUserResp.GetId(),
+		Items: []*orderpb.OrderItem{
+			{ProductId: productIDs[0], Quantity: 2},
+			{ProductId: productIDs[1], Quantity: 1},
+		},
+	})
+	if err != nil {
+		log.Fatalf("CreateOrder failed: %v", err)
+	}
+	log.Printf("Created Order: ID=%s, Status=%s", createOrderResp.GetId(), createOrderResp.GetStatus().GetMessage())
+
+	// Fetch the order
+	orderResp, err := orderClient.GetOrder(ctx, &orderpb.GetOrderRequest{Id: createOrderResp.GetId()})
+	if err != nil {
+		log.Fatalf("GetOrder failed: %v", err)
+	}
+	log.Printf("Fetched Order: %s, Subtotal=%s, Tax=%s, Total=%s, State=%s", orderResp.GetId(),
+		formatMoney(orderResp.GetSubtotal()), formatMoney(orderResp.GetTax()), formatMoney(orderResp.GetTotal()), orderResp.GetState())
+	for _, line := range orderResp.GetItems() {
+		log.Printf("  %d x %s @ %s = %s", line.GetQuantity(), line.GetSku(), formatMoney(line.GetUnitPrice()), formatMoney(line.GetTotal()))
+	}
+
+	// Pay the order, then try to cancel it, which the lifecycle doesn't allow
+	advanceOrderResp, err := orderClient.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: createOrderResp.GetId()})
+	if err != nil {
+		log.Fatalf("AdvanceOrder failed: %v", err)
+	}
+	log.Printf("Advanced Order: %s, State=%s", advanceOrderResp.GetId(), advanceOrderResp.GetState())
+
+	_, err = orderClient.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: createOrderResp.GetId()})
+	if status.Code(err) != codes.FailedPrecondition {
+		log.Fatalf("CancelOrder: expected FailedPrecondition, got %v", err)
+	}
+	logStatus("CancelOrder rejected as expected", err)
+
+	// List the orders of the user
+	listOrdersResp, err := orderClient.ListOrdersByUser(ctx, &orderpb.ListOrdersByUserRequest{UserId: createUserResp.GetId()})
+	if err != nil {
+		log.Fatalf("ListOrdersByUser failed: %v", err)
+	}
+	for _, o := range listOrdersResp.GetOrders() {
+		log.Printf("Listed Order: %s, State=%s, Transitions=%d", o.GetId(), o.GetState(), len(o.GetHistory()))
+	}
+
+	// Replay the events of the user's orders, the watch only ends with the context
+	watchCtx, stopWatching := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer stopWatching()
+	watch, err := orderClient.WatchOrders(watchCtx, &orderpb.WatchOrdersRequest{
+		UserId:        createUserResp.GetId(),
+		AfterSequence: proto.Uint64(0),
+	})
+	if err != nil {
+		log.Fatalf("WatchOrders failed: %v", err)
+	}
+	for {
+		event, err := watch.Recv()
+		if status.Code(err) == codes.DeadlineExceeded {
+			break
+		}
+		if err != nil {
+			log.Fatalf("WatchOrders failed: %v", err)
+		}
+		log.Printf("Order Event #%d: %s %s, State=%s", event.GetSequence(), event.GetType(), event.GetOrder().GetId(), event.GetOrder().GetState())
+	}
+	return nil
+}
+
+// logStatus prints the status code of a failed call and its error details.
+func logStatus(prefix string, err error) {
+	st := status.Convert(err)
+	log.Printf("%s: code=%s message=%q", prefix, st.Code(), st.Message())
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ResourceInfo:
+			log.Printf("  resource: type=%s name=%s", d.GetResourceType(), d.GetResourceName())
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				log.Printf("  field violation: %s: %s", v.GetField(), v.GetDescription())
+			}
+		case *errdetails.PreconditionFailure:
+			for _, v := range d.GetViolations() {
+				log.Printf("  precondition: %s %s: %s", v.GetType(), v.GetSubject(), v.GetDescription())
+			}
+		}
+	}
+}
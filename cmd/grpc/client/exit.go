@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes, scripts can tell failures apart without parsing the output.
+const (
+	exitOK           = 0
+	exitError        = 1 // any other failure, including codes without a dedicated exit code
+	exitUsage        = 2
+	exitInvalid      = 3 // InvalidArgument, OutOfRange
+	exitNotFound     = 4
+	exitConflict     = 5 // AlreadyExists, Aborted
+	exitPrecondition = 6 // FailedPrecondition
+	exitDenied       = 7 // Unauthenticated, PermissionDenied
+	exitUnavailable  = 8 // Unavailable, DeadlineExceeded, ResourceExhausted: worth retrying
+)
+
+var exitCodes = map[codes.Code]int{
+	codes.OK:                 exitOK,
+	codes.InvalidArgument:    exitInvalid,
+	codes.OutOfRange:         exitInvalid,
+	codes.NotFound:           exitNotFound,
+	codes.AlreadyExists:      exitConflict,
+	codes.Aborted:            exitConflict,
+	codes.FailedPrecondition: exitPrecondition,
+	codes.Unauthenticated:    exitDenied,
+	codes.PermissionDenied:   exitDenied,
+	codes.Unavailable:        exitUnavailable,
+	codes.DeadlineExceeded:   exitUnavailable,
+	codes.ResourceExhausted:  exitUnavailable,
+}
+
+// exit reports err on w and returns the exit code of the command.
+func exit(w io.Writer, err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return exitError
+	}
+	printStatus(w, st)
+	if code, ok := exitCodes[st.Code()]; ok {
+		return code
+	}
+	return exitError
+}
+
+// printStatus prints the status code of a failed call and its error details.
+func printStatus(w io.Writer, st *status.Status) {
+	fmt.Fprintf(w, "error: code=%s message=%q\n", st.Code(), st.Message())
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ResourceInfo:
+			fmt.Fprintf(w, "  resource: type=%s name=%s\n", d.GetResourceType(), d.GetResourceName())
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				fmt.Fprintf(w, "  field violation: %s: %s\n", v.GetField(), v.GetDescription())
+			}
+		case *errdetails.PreconditionFailure:
+			for _, v := range d.GetViolations() {
+				fmt.Fprintf(w, "  precondition: %s %s: %s\n", v.GetType(), v.GetSubject(), v.GetDescription())
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"help", flag.ErrHelp, exitOK},
+		{"usage", errUsage, exitUsage},
+		{"not a status", errors.New("connection refused"), exitError},
+		{"not found", status.Error(codes.NotFound, "missing"), exitNotFound},
+		{"invalid", status.Error(codes.InvalidArgument, "bad"), exitInvalid},
+		{"conflict", status.Error(codes.AlreadyExists, "taken"), exitConflict},
+		{"precondition", status.Error(codes.FailedPrecondition, "paid"), exitPrecondition},
+		{"unauthenticated", status.Error(codes.Unauthenticated, "no token"), exitDenied},
+		{"unavailable", status.Error(codes.Unavailable, "down"), exitUnavailable},
+		{"internal", status.Error(codes.Internal, "boom"), exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exit(io.Discard, tt.err); got != tt.want {
+				t.Errorf("Expected exit code %d, but got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	fs, opts := newFlagSet("order get", "<id>")
+	fs.SetOutput(io.Discard)
+
+	positional, err := parse(fs, []string{"o1", "-o", "json", "o2", "-timeout", "1s"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !slices.Equal(positional, []string{"o1", "o2"}) {
+		t.Errorf("Expected [o1 o2], but got %v", positional)
+	}
+	if opts.output != "json" || opts.timeout.String() != "1s" {
+		t.Errorf("Expected the flags after the arguments to be parsed, but got %+v", opts)
+	}
+
+	if _, err := parse(fs, []string{"-o", "xml"}); !errors.Is(err, errUsage) {
+		t.Errorf("Expected a usage error for an unknown format, but got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var errNotServing = errors.New("not serving")
+
+// runHealth checks the health of the server, or of one of its services. It
+// fails unless the status is SERVING, so it can be used as a probe.
+//
+//	client health -addr localhost:50051 -service order.OrderService
+func runHealth(args []string) error {
+	fs, opts := newFlagSet("health", "[-service name]")
+	service := fs.String("service", "", "service to check, empty for the whole server")
+	fs.Lookup("timeout").DefValue = "1s"
+	opts.timeout = time.Second
+	if positional, err := parse(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageErrorf(fs, "unexpected argument %q", positional[0])
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: *service})
+		if err != nil {
+			return err
+		}
+
+		if err := newPrinter(opts.output).print(resp, []string{"SERVICE", "STATUS"}, []string{*service, resp.GetStatus().String()}); err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("%w: %s", errNotServing, resp.GetStatus())
+		}
+		return nil
+	})
+}
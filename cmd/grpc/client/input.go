@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// readRequest fills m with the JSON request body in path, "-" reads it
+// from stdin and an empty path leaves m untouched. Both the proto and the
+// JSON field names are accepted.
+func readRequest(path string, m proto.Message) error {
+	if path == "" {
+		return nil
+	}
+
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("invalid request body in %s: %w", path, err)
+	}
+	return nil
+}
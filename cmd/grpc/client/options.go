@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go-learning/pkg/auth"
+	grpcclient "go-learning/pkg/grpc/client"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// errUsage is returned for invalid command lines, the flag set already
+// printed what was wrong.
+var errUsage = errors.New("invalid usage")
+
+// options are the flags shared by every command.
+type options struct {
+	addr       string
+	timeout    time.Duration
+	tls        bool
+	caFile     string
+	serverName string
+	token      string
+	output     string
+	hedge      time.Duration
+}
+
+// newFlagSet returns the flag set of a command with the shared flags
+// registered. Defaults for the token come from GRPC_AUTH_TOKEN.
+func newFlagSet(name, usage string) (*flag.FlagSet, *options) {
+	opts := &options{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&opts.addr, "addr", "localhost:50051", "server address, a comma separated list to balance the calls")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "deadline of the call, 0 for none")
+	fs.BoolVar(&opts.tls, "tls", false, "connect with TLS")
+	fs.StringVar(&opts.caFile, "ca-file", "", "PEM file of the CAs to trust, the system pool when empty (implies -tls)")
+	fs.StringVar(&opts.serverName, "server-name", "", "name expected in the server certificate, the host of -addr when empty")
+	fs.StringVar(&opts.token, "token", os.Getenv("GRPC_AUTH_TOKEN"), "bearer token, signed with GRPC_AUTH_SECRET when empty and the secret is set")
+	fs.StringVar(&opts.output, "o", "table", "output format: table, json or yaml")
+	fs.DurationVar(&opts.hedge, "hedge", 0, "send GetUser and GetOrder again to another server when no reply came after this delay, 0 disables hedging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: client %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs, opts
+}
+
+// parse parses flags placed before, after or between the positional
+// arguments, and returns the positional ones.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch format := fs.Lookup("o").Value.String(); format {
+	case "table", "json", "yaml":
+	default:
+		return nil, usageErrorf(fs, "unknown output format %q", format)
+	}
+	return positional, nil
+}
+
+// usageErrorf reports an invalid command line and returns errUsage.
+func usageErrorf(fs *flag.FlagSet, format string, args ...any) error {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+// dial connects to the servers, the connection is established lazily by
+// the first call. Idempotent calls are retried when a server is down.
+func (o *options) dial() (*grpc.ClientConn, error) {
+	clientOpts := grpcclient.Options{Addresses: strings.Split(o.addr, ",")}
+	if o.tls || o.caFile != "" {
+		clientOpts.TLS = &tls.Config{ServerName: o.serverName, MinVersion: tls.VersionTLS12}
+		if o.caFile != "" {
+			pem, err := os.ReadFile(o.caFile)
+			if err != nil {
+				return nil, err
+			}
+			clientOpts.TLS.RootCAs = x509.NewCertPool()
+			if !clientOpts.TLS.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in %s", o.caFile)
+			}
+		}
+	}
+	if o.hedge > 0 {
+		clientOpts.Hedging = &grpcclient.HedgingPolicy{MaxAttempts: 2, Delay: o.hedge}
+	}
+	return grpcclient.New(clientOpts)
+}
+
+// context returns the context of a call, with the deadline and the bearer
+// token. In development the token can be signed locally with the server's
+// secret.
+func (o *options) context(parent context.Context) (context.Context, context.CancelFunc, error) {
+	token := o.token
+	if secret := os.Getenv("GRPC_AUTH_SECRET"); token == "" && secret != "" {
+		var err error
+		if token, err = auth.GenerateJWT([]byte(secret), "grpc-client", time.Hour); err != nil {
+			return nil, nil, fmt.Errorf("could not sign a token: %w", err)
+		}
+	}
+
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if o.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, o.timeout)
+	}
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	return ctx, cancel, nil
+}
+
+// call dials the server and runs fn with the context of the call, derived
+// from parent.
+func (o *options) call(parent context.Context, fn func(ctx context.Context, conn *grpc.ClientConn) error) error {
+	conn, err := o.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel, err := o.context(parent)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	return fn(ctx, conn)
+}
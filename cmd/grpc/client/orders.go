@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	orderpb "go-learning/pkg/grpc/order"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var orderCommands = commands{
+	"create": orderCreate,
+	"get":    orderGet,
+	"cancel": orderCancel,
+	"watch":  orderWatch,
+}
+
+var orderColumns = []string{"ID", "USER", "STATE", "ITEMS", "TOTAL"}
+
+func orderRow(o *orderpb.GetOrderReply) []string {
+	return []string{
+		o.GetId(),
+		o.GetUserId(),
+		strings.TrimPrefix(o.GetState().String(), "ORDER_STATE_"),
+		strconv.Itoa(len(o.GetItems())),
+		formatMoney(o.GetTotal()),
+	}
+}
+
+// itemsFlag collects the -item flags, "product" or "product:quantity".
+type itemsFlag []*orderpb.OrderItem
+
+func (f *itemsFlag) String() string { return "" }
+
+func (f *itemsFlag) Set(value string) error {
+	productID, quantity, found := strings.Cut(value, ":")
+	item := &orderpb.OrderItem{ProductId: productID, Quantity: 1}
+	if found {
+		n, err := strconv.ParseInt(quantity, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid quantity %q", quantity)
+		}
+		item.Quantity = n
+	}
+	*f = append(*f, item)
+	return nil
+}
+
+func orderCreate(args []string) error {
+	fs, opts := newFlagSet("order create", "[-f file] [-user id] [-item product[:quantity]]... [-request-id id]")
+	file := fs.String("f", "", "JSON request body, - for stdin")
+	userID := fs.String("user", "", "id of the user placing the order, overrides the body")
+	requestID := fs.String("request-id", "", "makes the creation safe to retry, the same id returns the same order")
+	var items itemsFlag
+	fs.Var(&items, "item", "product to order, with an optional quantity, repeatable; replaces the items of the body")
+	if positional, err := parse(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageErrorf(fs, "unexpected argument %q", positional[0])
+	}
+
+	req := &orderpb.CreateOrderRequest{}
+	if err := readRequest(*file, req); err != nil {
+		return err
+	}
+	if *userID != "" {
+		req.UserId = *userID
+	}
+	if len(items) > 0 {
+		req.Items = items
+	}
+	if *requestID != "" {
+		req.RequestId = *requestID
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := orderpb.NewOrderServiceClient(conn).CreateOrder(ctx, req)
+		if err != nil {
+			return err
+		}
+		return newPrinter(opts.output).print(resp, []string{"ID", "STATUS"},
+			[]string{resp.GetId(), resp.GetStatus().GetMessage()})
+	})
+}
+
+func orderGet(args []string) error {
+	fs, opts := newFlagSet("order get", "<id>")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := orderpb.NewOrderServiceClient(conn).GetOrder(ctx, &orderpb.GetOrderRequest{Id: id})
+		if err != nil {
+			return err
+		}
+		return newPrinter(opts.output).print(resp, orderColumns, orderRow(resp))
+	})
+}
+
+func orderCancel(args []string) error {
+	fs, opts := newFlagSet("order cancel", "<id>")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := orderpb.NewOrderServiceClient(conn).CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: id})
+		if err != nil {
+			return err
+		}
+		return newPrinter(opts.output).print(resp, orderColumns, orderRow(resp))
+	})
+}
+
+// orderWatch prints the order events until interrupted. With -o json each
+// event is a line, with -o yaml a document.
+func orderWatch(args []string) error {
+	fs, opts := newFlagSet("order watch", "[-user id] [-order id] [-after sequence]")
+	userID := fs.String("user", "", "only the orders of this user")
+	orderID := fs.String("order", "", "only this order")
+	after := fs.String("after", "", "replay the retained events after this sequence, 0 for all of them")
+	// a watch runs until interrupted, unless a timeout is given
+	opts.timeout = 0
+	fs.Lookup("timeout").DefValue = "0s"
+	if positional, err := parse(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageErrorf(fs, "unexpected argument %q", positional[0])
+	}
+
+	req := &orderpb.WatchOrdersRequest{UserId: *userID, OrderId: *orderID}
+	if *after != "" {
+		seq, err := strconv.ParseUint(*after, 10, 64)
+		if err != nil {
+			return usageErrorf(fs, "invalid sequence %q", *after)
+		}
+		req.AfterSequence = &seq
+	}
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return opts.call(interrupted, func(ctx context.Context, conn *grpc.ClientConn) error {
+		stream, err := orderpb.NewOrderServiceClient(conn).WatchOrders(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		p := newPrinter(opts.output)
+		p.stream = true
+		for {
+			event, err := stream.Recv()
+			switch {
+			case err == nil:
+			case errors.Is(err, io.EOF):
+				return nil
+			case interrupted.Err() != nil && status.Code(err) == codes.Canceled:
+				return nil
+			case opts.timeout > 0 && status.Code(err) == codes.DeadlineExceeded:
+				// the watch lasted as long as requested
+				return nil
+			default:
+				return err
+			}
+
+			err = p.print(event, []string{"SEQ", "EVENT", "AT", "ID", "USER", "STATE", "ITEMS", "TOTAL"}, append([]string{
+				strconv.FormatUint(event.GetSequence(), 10),
+				strings.TrimPrefix(event.GetType().String(), "ORDER_EVENT_TYPE_"),
+				event.GetAt().AsTime().Local().Format(time.TimeOnly),
+			}, orderRow(event.GetOrder())...))
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"go-learning/internal/money"
+	common "go-learning/pkg/grpc/common"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// printer writes replies as a table, JSON or YAML. JSON and YAML use the
+// proto field names, like the REST gateway.
+type printer struct {
+	w      io.Writer
+	format string
+	// stream prints one document per message: JSON lines, YAML documents
+	// separated by ---, and table rows under a single header.
+	stream bool
+	header bool // the table header was printed
+}
+
+func newPrinter(format string) *printer {
+	return &printer{w: os.Stdout, format: format}
+}
+
+// print writes m, or the rows under columns for a table.
+func (p *printer) print(m proto.Message, columns []string, rows ...[]string) error {
+	switch p.format {
+	case "json":
+		opts := protojson.MarshalOptions{UseProtoNames: true}
+		if !p.stream {
+			opts.Multiline, opts.Indent = true, "  "
+		}
+		b, err := opts.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", b)
+		return err
+	case "yaml":
+		b, err := marshalYAML(m)
+		if err != nil {
+			return err
+		}
+		if p.stream {
+			b = append([]byte("---\n"), b...)
+		}
+		_, err = p.w.Write(b)
+		return err
+	default:
+		// rows of a stream are flushed one by one, a minimum width keeps
+		// most of them aligned
+		minWidth := 0
+		if p.stream {
+			minWidth = 10
+		}
+		tw := tabwriter.NewWriter(p.w, minWidth, 0, 2, ' ', 0)
+		if !p.header {
+			fmt.Fprintln(tw, strings.Join(columns, "\t"))
+			p.header = p.stream
+		}
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// marshalYAML converts the JSON of m to YAML. JSON being valid YAML, it is
+// decoded into a node, which keeps the field order, and the node is written
+// back in block style.
+func marshalYAML(m proto.Message) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func formatMoney(m *common.Money) string {
+	if m == nil {
+		return ""
+	}
+	return money.New(m.GetAmount(), m.GetCurrency()).String()
+}
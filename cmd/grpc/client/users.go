@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc"
+)
+
+var userCommands = commands{
+	"create": userCreate,
+	"get":    userGet,
+	"list":   userList,
+	"delete": userDelete,
+}
+
+var userColumns = []string{"ID", "NAME", "EMAIL"}
+
+func userRow(u *userpb.GetUserReply) []string {
+	return []string{u.GetId(), u.GetName(), u.GetEmail()}
+}
+
+func userCreate(args []string) error {
+	fs, opts := newFlagSet("user create", "[-f file] [-name name] [-email email] [-request-id id]")
+	file := fs.String("f", "", "JSON request body, - for stdin")
+	name := fs.String("name", "", "name of the user, overrides the body")
+	email := fs.String("email", "", "email of the user, overrides the body")
+	requestID := fs.String("request-id", "", "makes the creation safe to retry, the same id returns the same user")
+	if positional, err := parse(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageErrorf(fs, "unexpected argument %q", positional[0])
+	}
+
+	req := &userpb.CreateUserRequest{}
+	if err := readRequest(*file, req); err != nil {
+		return err
+	}
+	if *name != "" {
+		req.Name = *name
+	}
+	if *email != "" {
+		req.Email = *email
+	}
+	if *requestID != "" {
+		req.RequestId = *requestID
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := userpb.NewUserServiceClient(conn).CreateUser(ctx, req)
+		if err != nil {
+			return err
+		}
+		return newPrinter(opts.output).print(resp, []string{"ID", "STATUS"},
+			[]string{resp.GetId(), resp.GetStatus().GetMessage()})
+	})
+}
+
+func userGet(args []string) error {
+	fs, opts := newFlagSet("user get", "<id>")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := userpb.NewUserServiceClient(conn).GetUser(ctx, &userpb.GetUserRequest{Id: id})
+		if err != nil {
+			return err
+		}
+		return newPrinter(opts.output).print(resp, userColumns, userRow(resp))
+	})
+}
+
+func userList(args []string) error {
+	fs, opts := newFlagSet("user list", "[-f file] [-page-size n] [-page-token token] [-all] [-name text] [-email text]")
+	file := fs.String("f", "", "JSON request body, - for stdin")
+	pageSize := fs.Int("page-size", 0, "users per page, the server default when 0")
+	pageToken := fs.String("page-token", "", "token of the page to fetch")
+	all := fs.Bool("all", false, "fetch every page")
+	name := fs.String("name", "", "only the users whose name contains this text")
+	email := fs.String("email", "", "only the users whose email contains this text")
+	if positional, err := parse(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageErrorf(fs, "unexpected argument %q", positional[0])
+	}
+
+	req := &userpb.ListUsersRequest{}
+	if err := readRequest(*file, req); err != nil {
+		return err
+	}
+	if *pageSize != 0 {
+		req.PageSize = int32(*pageSize)
+	}
+	if *pageToken != "" {
+		req.PageToken = *pageToken
+	}
+	if *name != "" {
+		req.NameContains = *name
+	}
+	if *email != "" {
+		req.EmailContains = *email
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		client := userpb.NewUserServiceClient(conn)
+		resp, err := client.ListUsers(ctx, req)
+		if err != nil {
+			return err
+		}
+		// the pages are merged into a single reply
+		for *all && resp.GetNextPageToken() != "" {
+			req.PageToken = resp.GetNextPageToken()
+			page, err := client.ListUsers(ctx, req)
+			if err != nil {
+				return err
+			}
+			resp.Users = append(resp.Users, page.GetUsers()...)
+			resp.NextPageToken = page.GetNextPageToken()
+		}
+
+		rows := make([][]string, 0, len(resp.GetUsers()))
+		for _, u := range resp.GetUsers() {
+			rows = append(rows, userRow(u))
+		}
+		if err := newPrinter(opts.output).print(resp, userColumns, rows...); err != nil {
+			return err
+		}
+		if opts.output == "table" && resp.GetNextPageToken() != "" {
+			printNextPage(resp.GetNextPageToken())
+		}
+		return nil
+	})
+}
+
+func userDelete(args []string) error {
+	fs, opts := newFlagSet("user delete", "<id>")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	return opts.call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+		resp, err := userpb.NewUserServiceClient(conn).DeleteUser(ctx, &userpb.DeleteUserRequest{Id: id})
+		if err != nil {
+			return err
+		}
+		return newPrinter(opts.output).print(resp, []string{"ID", "STATUS"},
+			[]string{id, resp.GetStatus().GetMessage()})
+	})
+}
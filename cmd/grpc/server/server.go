@@ -1,31 +1,279 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net"
-	"sync"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"go-learning/internal/admin"
+	"go-learning/internal/config"
+	"go-learning/internal/interceptors"
+	"go-learning/internal/logging"
+	"go-learning/internal/orders"
+	"go-learning/internal/outbox"
+	"go-learning/internal/services"
+	"go-learning/pkg/events"
 	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
 	userpb "go-learning/pkg/grpc/user"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip requests, and send gzip replies when enabled
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 )
 
-var mu sync.Mutex // protect concurrent access
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	GitCommit = "unknown"
+)
 
 func main() {
-	lis, err := net.Listen("tcp", ":50051")
+	cfg := config.LoadConfig()
+	logLevel := logging.Setup(cfg.LogLevel, cfg.LogFormat)
+
+	var adminServer *http.Server
+	if cfg.Admin.Token != "" {
+		adminServer = admin.NewServer(admin.Options{
+			Addr:   cfg.Admin.Addr,
+			Token:  cfg.Admin.Token,
+			Config: cfg.Redacted(),
+			Build: map[string]string{
+				"version":    Version,
+				"build_time": BuildTime,
+				"git_commit": GitCommit,
+			},
+			Level: logLevel,
+		})
+		go func() {
+			slog.Info("admin server started", slog.String("addr", adminServer.Addr))
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start admin server", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	lis, err := net.Listen("tcp", cfg.GRPC.Addr)
+	if err != nil {
+		slog.Error("failed to listen", slog.String("addr", cfg.GRPC.Addr), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	inFlight := &interceptors.InFlight{}
+	opts, err := serverOptions(cfg.GRPC, inFlight)
+	if err != nil {
+		slog.Error("invalid gRPC server configuration", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	stores, err := services.Open(cfg.Store)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		slog.Error("failed to open the stores", slog.String("dir", cfg.Store.Dir), slog.String("error", err.Error()))
+		os.Exit(1)
 	}
 
-	grpcServer := grpc.NewServer()
-	userpb.RegisterUserServiceServer(grpcServer, &userServer{})
-	orderpb.RegisterOrderServiceServer(grpcServer, &orderServer{})
+	// the services publish their domain events, the audit log is the first
+	// subscriber
+	bus := events.New(events.Options{})
+	if err := events.Subscribe(bus, "audit", events.Log(slog.Default()), events.SubscribeOptions{}); err != nil {
+		slog.Error("failed to subscribe the audit log", slog.String("error", err.Error()))
+	}
+	publish := services.WithEvents(bus)
+	// the order events are written to the outbox with the orders and
+	// relayed to the bus from there
+	stopRelay, err := outbox.Start(cfg.Outbox, stores.Outbox, bus, prometheus.DefaultRegisterer)
+	if err != nil {
+		slog.Error("failed to start the outbox relay", slog.String("file", cfg.Outbox.File), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	userpb.RegisterUserServiceServer(grpcServer, services.NewUserServer(stores, cfg.Idempotency.Window, publish))
+	orderServer := services.NewOrderServer(stores, orders.Pricing{TaxBasisPoints: cfg.Orders.TaxBasisPoints}, cfg.Idempotency.Window, publish)
+	orderpb.RegisterOrderServiceServer(grpcServer, orderServer)
+	productpb.RegisterProductServiceServer(grpcServer, services.NewProductServer(stores, publish))
+
+	// Standard health checks, per service and for the server as a whole
+	// (empty service name), and reflection for tools such as grpcurl.
+	healthServer := health.NewServer()
+	for _, service := range []string{
+		"",
+		userpb.UserService_ServiceDesc.ServiceName,
+		orderpb.OrderService_ServiceDesc.ServiceName,
+		productpb.ProductService_ServiceDesc.ServiceName,
+	} {
+		healthServer.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+
+	var metricsServer *http.Server
+	if cfg.GRPC.MetricsAddr != "" {
+		metricsServer = &http.Server{
+			Addr:              cfg.GRPC.MetricsAddr,
+			Handler:           promhttp.Handler(),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			slog.Info("metrics server started", slog.String("addr", metricsServer.Addr))
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start metrics server", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	go func() {
+		slog.Info("gRPC server started", slog.String("addr", lis.Addr().String()), slog.Bool("tls", cfg.GRPC.TLSCertFile != ""))
+		if err := grpcServer.Serve(lis); err != nil {
+			slog.Error("failed to serve", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("shutting down server...", slog.Int64("active_rpcs", inFlight.Count()))
+
+	// Report NOT_SERVING first, so load balancers stop sending new RPCs
+	// while the ones in flight finish.
+	healthServer.Shutdown()
+	// order watches would otherwise hold the graceful stop until the timeout
+	orderServer.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		slog.Info("server exited gracefully")
+	case <-time.After(cfg.GRPC.ShutdownTimeout):
+		// streams such as health watches never end on their own
+		slog.Warn("graceful shutdown timed out, cancelling the remaining RPCs",
+			slog.Int64("active_rpcs", inFlight.Count()),
+			slog.Duration("timeout", cfg.GRPC.ShutdownTimeout),
+		)
+		grpcServer.Stop()
+	}
 
-	fmt.Println("gRPC server running on :50051")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the events of the last orders are relayed while the journal is open,
+	// those left are relayed on the next start if the stores are persisted
+	if err := stopRelay(ctx); err != nil {
+		slog.Error("outbox not fully relayed", slog.String("error", err.Error()))
 	}
+	// no RPC changes the stores anymore, the last snapshot spares the
+	// next start from replaying the journal
+	if err := stores.Close(); err != nil {
+		slog.Error("failed to close the stores", slog.String("error", err.Error()))
+	}
+
+	// the events of the last RPCs are handled before exiting
+	if err := bus.Close(ctx); err != nil {
+		slog.Error("event bus forced to close", slog.String("error", err.Error()))
+	}
+
+	// The metrics and admin servers go last so they stay available while RPCs drain
+	for _, server := range []*http.Server{metricsServer, adminServer} {
+		if server == nil {
+			continue
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("server forced to shutdown", slog.String("addr", server.Addr), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// serverOptions builds the transport options and the interceptor chains.
+// The legacy status interceptor comes first so logs and metrics still see
+// the real codes, recovery comes last so a panic is logged and counted as
+// Internal.
+func serverOptions(cfg config.GRPCConfig, inFlight *interceptors.InFlight) ([]grpc.ServerOption, error) {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:              cfg.Keepalive.Time,
+			Timeout:           cfg.Keepalive.Timeout,
+			MaxConnectionIdle: cfg.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:  cfg.Keepalive.MaxConnectionAge,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Keepalive.MinTime,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}),
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+
+	switch {
+	case cfg.TLSCertFile != "" && cfg.TLSKeyFile != "":
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	case cfg.TLSCertFile != "" || cfg.TLSKeyFile != "":
+		return nil, errors.New("GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE must be set together")
+	}
+
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+
+	if cfg.LegacyResponseStatus {
+		slog.Warn("legacy response status enabled, errors are returned as successful replies")
+		unary = append(unary, services.LegacyResponseStatusInterceptor)
+	}
+
+	metrics := interceptors.NewMetrics(prometheus.DefaultRegisterer)
+	unary = append(unary, interceptors.UnaryLogging(), metrics.Unary(), inFlight.Unary())
+	stream = append(stream, interceptors.StreamLogging(), metrics.Stream(), inFlight.Stream())
+
+	switch cfg.Compression {
+	case "":
+	case "gzip":
+		unary = append(unary, interceptors.UnaryCompression(cfg.Compression))
+		stream = append(stream, interceptors.StreamCompression(cfg.Compression))
+	default:
+		return nil, errors.New("GRPC_COMPRESSION must be empty or gzip")
+	}
+
+	if cfg.AuthSecret != "" {
+		// probes don't have a token, and reflection only exposes the protos
+		public := append([]string{
+			"/grpc.health.v1.Health/*",
+			"/grpc.reflection.v1.ServerReflection/*",
+			"/grpc.reflection.v1alpha.ServerReflection/*",
+		}, cfg.PublicMethods...)
+		authenticator := interceptors.Auth{Secret: []byte(cfg.AuthSecret), Public: public}
+		unary = append(unary, authenticator.Unary())
+		stream = append(stream, authenticator.Stream())
+	} else {
+		slog.Warn("GRPC_AUTH_SECRET is not set, every RPC is public")
+	}
+
+	unary = append(unary, interceptors.UnaryRecovery())
+	stream = append(stream, interceptors.StreamRecovery())
+
+	return append(opts,
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	), nil
 }
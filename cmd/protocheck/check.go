@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Kinds of breaking changes.
+const (
+	messageRemoved     = "message_removed"
+	fieldRemoved       = "field_removed"
+	fieldRenumbered    = "field_renumbered"
+	fieldRenamed       = "field_renamed"
+	fieldTypeChanged   = "field_type_changed"
+	reservedReused     = "reserved_reused"
+	enumRemoved        = "enum_removed"
+	enumValueRemoved   = "enum_value_removed"
+	enumValueRenamed   = "enum_value_renamed"
+	serviceRemoved     = "service_removed"
+	rpcRemoved         = "rpc_removed"
+	rpcSignatureChange = "rpc_signature_changed"
+)
+
+// breakingChange is a change of the current protos that breaks clients
+// built against the baseline.
+type breakingChange struct {
+	File    string `json:"file"`
+	Element string `json:"element"` // full name of the message, enum or service
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// String formats the change as a line of the text output.
+func (c breakingChange) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", c.File, c.Element, c.Message, c.Kind)
+}
+
+// index finds the definitions of a descriptor set by full name, so a type
+// moved to another file is still matched.
+type index struct {
+	messages map[string]*descriptorpb.DescriptorProto
+	enums    map[string]*descriptorpb.EnumDescriptorProto
+	services map[string]*descriptorpb.ServiceDescriptorProto
+}
+
+func newIndex(set *descriptorpb.FileDescriptorSet) index {
+	idx := index{
+		messages: map[string]*descriptorpb.DescriptorProto{},
+		enums:    map[string]*descriptorpb.EnumDescriptorProto{},
+		services: map[string]*descriptorpb.ServiceDescriptorProto{},
+	}
+	for _, file := range set.GetFile() {
+		idx.addFile(file)
+	}
+	return idx
+}
+
+func (idx index) addFile(file *descriptorpb.FileDescriptorProto) {
+	scope := file.GetPackage()
+	for _, m := range file.GetMessageType() {
+		idx.addMessage(scope, m)
+	}
+	for _, e := range file.GetEnumType() {
+		idx.enums[fullName(scope, e.GetName())] = e
+	}
+	for _, s := range file.GetService() {
+		idx.services[fullName(scope, s.GetName())] = s
+	}
+}
+
+func (idx index) addMessage(scope string, m *descriptorpb.DescriptorProto) {
+	name := fullName(scope, m.GetName())
+	idx.messages[name] = m
+	for _, nested := range m.GetNestedType() {
+		idx.addMessage(name, nested)
+	}
+	for _, e := range m.GetEnumType() {
+		idx.enums[fullName(name, e.GetName())] = e
+	}
+}
+
+func fullName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// check compares the current descriptor set to the baseline and returns
+// the breaking changes, in the order of the baseline.
+func check(baseline, current *descriptorpb.FileDescriptorSet) []breakingChange {
+	c := checker{current: newIndex(current), changes: []breakingChange{}}
+	for _, file := range baseline.GetFile() {
+		c.file = file.GetName()
+		scope := file.GetPackage()
+		for _, m := range file.GetMessageType() {
+			c.message(scope, m)
+		}
+		for _, e := range file.GetEnumType() {
+			c.enum(scope, e)
+		}
+		for _, s := range file.GetService() {
+			c.service(scope, s)
+		}
+	}
+	return c.changes
+}
+
+type checker struct {
+	current index
+	file    string // of the baseline definition being checked
+	changes []breakingChange
+}
+
+func (c *checker) report(element, kind, format string, args ...any) {
+	c.changes = append(c.changes, breakingChange{
+		File:    c.file,
+		Element: element,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) message(scope string, old *descriptorpb.DescriptorProto) {
+	name := fullName(scope, old.GetName())
+	for _, nested := range old.GetNestedType() {
+		c.message(name, nested)
+	}
+	for _, e := range old.GetEnumType() {
+		c.enum(name, e)
+	}
+
+	cur, ok := c.current.messages[name]
+	if !ok {
+		c.report(name, messageRemoved, "message was removed")
+		return
+	}
+
+	byNumber := map[int32]*descriptorpb.FieldDescriptorProto{}
+	byName := map[string]*descriptorpb.FieldDescriptorProto{}
+	for _, f := range cur.GetField() {
+		byNumber[f.GetNumber()] = f
+		byName[f.GetName()] = f
+	}
+
+	for _, f := range old.GetField() {
+		now, ok := byNumber[f.GetNumber()]
+		if !ok {
+			switch moved, ok := byName[f.GetName()]; {
+			case ok:
+				c.report(name, fieldRenumbered, "field %q was renumbered from %d to %d", f.GetName(), f.GetNumber(), moved.GetNumber())
+			case !reservedNumber(cur.GetReservedRange(), f.GetNumber()):
+				c.report(name, fieldRemoved, "field %d %q was removed without reserving its number", f.GetNumber(), f.GetName())
+			}
+			continue
+		}
+		if now.GetName() != f.GetName() {
+			// the wire format doesn't mind, JSON clients do
+			c.report(name, fieldRenamed, "field %d was renamed from %q to %q", f.GetNumber(), f.GetName(), now.GetName())
+		}
+		if was, is := fieldType(f), fieldType(now); was != is {
+			c.report(name, fieldTypeChanged, "field %d %q changed type from %s to %s", f.GetNumber(), f.GetName(), was, is)
+		}
+	}
+
+	for _, f := range cur.GetField() {
+		if reservedNumber(old.GetReservedRange(), f.GetNumber()) {
+			c.report(name, reservedReused, "field %q uses the reserved number %d", f.GetName(), f.GetNumber())
+		}
+		if slices.Contains(old.GetReservedName(), f.GetName()) {
+			c.report(name, reservedReused, "field %d uses the reserved name %q", f.GetNumber(), f.GetName())
+		}
+	}
+}
+
+// fieldType describes the type of a field, with its cardinality.
+func fieldType(f *descriptorpb.FieldDescriptorProto) string {
+	t := strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+	if f.GetTypeName() != "" {
+		t = strings.TrimPrefix(f.GetTypeName(), ".")
+	}
+	if f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		t = "repeated " + t
+	}
+	return t
+}
+
+// reservedNumber reports whether n is in the reserved ranges of a message,
+// whose ends are exclusive.
+func reservedNumber(ranges []*descriptorpb.DescriptorProto_ReservedRange, n int32) bool {
+	for _, r := range ranges {
+		if n >= r.GetStart() && n < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) enum(scope string, old *descriptorpb.EnumDescriptorProto) {
+	name := fullName(scope, old.GetName())
+	cur, ok := c.current.enums[name]
+	if !ok {
+		c.report(name, enumRemoved, "enum was removed")
+		return
+	}
+
+	byNumber := map[int32]*descriptorpb.EnumValueDescriptorProto{}
+	for _, v := range cur.GetValue() {
+		byNumber[v.GetNumber()] = v
+	}
+	for _, v := range old.GetValue() {
+		now, ok := byNumber[v.GetNumber()]
+		switch {
+		case !ok && !reservedEnumNumber(cur.GetReservedRange(), v.GetNumber()):
+			c.report(name, enumValueRemoved, "value %d %s was removed without reserving its number", v.GetNumber(), v.GetName())
+		case ok && now.GetName() != v.GetName():
+			c.report(name, enumValueRenamed, "value %d was renamed from %s to %s", v.GetNumber(), v.GetName(), now.GetName())
+		}
+	}
+
+	for _, v := range cur.GetValue() {
+		if reservedEnumNumber(old.GetReservedRange(), v.GetNumber()) {
+			c.report(name, reservedReused, "value %s uses the reserved number %d", v.GetName(), v.GetNumber())
+		}
+		if slices.Contains(old.GetReservedName(), v.GetName()) {
+			c.report(name, reservedReused, "value %d uses the reserved name %s", v.GetNumber(), v.GetName())
+		}
+	}
+}
+
+// reservedEnumNumber is reservedNumber for enums, whose range ends are
+// inclusive.
+func reservedEnumNumber(ranges []*descriptorpb.EnumDescriptorProto_EnumReservedRange, n int32) bool {
+	for _, r := range ranges {
+		if n >= r.GetStart() && n <= r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) service(scope string, old *descriptorpb.ServiceDescriptorProto) {
+	name := fullName(scope, old.GetName())
+	cur, ok := c.current.services[name]
+	if !ok {
+		c.report(name, serviceRemoved, "service was removed")
+		return
+	}
+
+	methods := map[string]*descriptorpb.MethodDescriptorProto{}
+	for _, m := range cur.GetMethod() {
+		methods[m.GetName()] = m
+	}
+	for _, m := range old.GetMethod() {
+		now, ok := methods[m.GetName()]
+		if !ok {
+			c.report(name, rpcRemoved, "rpc %s was removed", m.GetName())
+			continue
+		}
+		if was, is := signature(m), signature(now); was != is {
+			c.report(name, rpcSignatureChange, "rpc %s changed from %s to %s", m.GetName(), was, is)
+		}
+	}
+}
+
+// signature describes the request and reply of an rpc.
+func signature(m *descriptorpb.MethodDescriptorProto) string {
+	stream := func(streaming bool, t string) string {
+		t = strings.TrimPrefix(t, ".")
+		if streaming {
+			return "stream " + t
+		}
+		return t
+	}
+	return fmt.Sprintf("(%s) returns (%s)",
+		stream(m.GetClientStreaming(), m.GetInputType()), stream(m.GetServerStreaming(), m.GetOutputType()))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// TestBaseline fails on breaking changes to api/proto, and when pkg/grpc
+// wasn't generated from it.
+func TestBaseline(t *testing.T) {
+	root := filepath.Join("..", "..")
+	var out bytes.Buffer
+	code := run([]string{
+		"-root", root,
+		"-baseline", filepath.Join(root, protoDir, "baseline.binpb"),
+	}, &out, &out)
+	if code != exitOK {
+		t.Errorf("Expected no breaking changes, but got\n%s", out.String())
+	}
+}
+
+// nickname is a field GetUserReply doesn't have.
+func nickname() *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String("nickname"),
+		Number: proto.Int32(20),
+		Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	set, err := compile(filepath.Join("..", ".."), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generated(set); err != nil {
+		t.Fatalf("Expected pkg/grpc to be up to date, but got %v", err)
+	}
+
+	m, _ := find(set, "user.GetUserReply")
+	m.Field = append(m.Field, nickname())
+	err = generated(set)
+	if err == nil || !strings.Contains(err.Error(), "api/proto/user/user.proto") {
+		t.Errorf("Expected user.proto to be out of date, but got %v", err)
+	}
+}
+
+// find returns the message or enum called name in set.
+func find(set *descriptorpb.FileDescriptorSet, name string) (*descriptorpb.DescriptorProto, *descriptorpb.EnumDescriptorProto) {
+	idx := newIndex(set)
+	return idx.messages[name], idx.enums[name]
+}
+
+func field(m *descriptorpb.DescriptorProto, name string) *descriptorpb.FieldDescriptorProto {
+	for _, f := range m.GetField() {
+		if f.GetName() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func removeField(m *descriptorpb.DescriptorProto, name string) {
+	for i, f := range m.GetField() {
+		if f.GetName() == name {
+			m.Field = append(m.Field[:i], m.Field[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(set *descriptorpb.FileDescriptorSet)
+		want   []string // kinds of the breaking changes
+	}{
+		{"unchanged", func(*descriptorpb.FileDescriptorSet) {}, nil},
+		{"field removed", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "user.GetUserReply")
+			removeField(m, "email")
+		}, []string{fieldRemoved}},
+		{"field removed and reserved", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "user.GetUserReply")
+			removeField(m, "email")
+			m.ReservedRange = append(m.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(3), End: proto.Int32(4)})
+			m.ReservedName = append(m.ReservedName, "email")
+		}, nil},
+		{"field renumbered", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "user.GetUserReply")
+			field(m, "email").Number = proto.Int32(20)
+		}, []string{fieldRenumbered}},
+		{"field renamed", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "user.GetUserReply")
+			field(m, "email").Name = proto.String("mail")
+		}, []string{fieldRenamed}},
+		{"scalar type changed", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "product.GetProductReply")
+			field(m, "stock").Type = descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum()
+		}, []string{fieldTypeChanged}},
+		{"message type changed", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "product.GetProductReply")
+			field(m, "price").TypeName = proto.String(".common.ResponseStatus")
+		}, []string{fieldTypeChanged}},
+		{"made repeated", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "product.GetProductReply")
+			field(m, "name").Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}, []string{fieldTypeChanged}},
+		{"reserved number reused", func(set *descriptorpb.FileDescriptorSet) {
+			m, _ := find(set, "product.GetProductReply")
+			m.ReservedRange = nil
+			m.Field = append(m.Field, &descriptorpb.FieldDescriptorProto{
+				Name: proto.String("description"), Number: proto.Int32(8), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			})
+		}, []string{reservedReused}},
+		{"message removed", func(set *descriptorpb.FileDescriptorSet) {
+			file := set.File[0]
+			file.MessageType = file.MessageType[1:]
+		}, []string{messageRemoved}},
+		{"enum value removed", func(set *descriptorpb.FileDescriptorSet) {
+			_, e := find(set, "order.OrderState")
+			e.Value = e.Value[:len(e.Value)-1]
+		}, []string{enumValueRemoved}},
+		{"rpc removed", func(set *descriptorpb.FileDescriptorSet) {
+			for _, file := range set.File {
+				for _, s := range file.Service {
+					if s.GetName() == "UserService" {
+						s.Method = s.Method[1:]
+					}
+				}
+			}
+		}, []string{rpcRemoved}},
+		{"rpc made streaming", func(set *descriptorpb.FileDescriptorSet) {
+			for _, file := range set.File {
+				for _, s := range file.Service {
+					if s.GetName() == "OrderService" {
+						s.Method[0].ServerStreaming = proto.Bool(true)
+					}
+				}
+			}
+		}, []string{rpcSignatureChange}},
+	}
+
+	baseline, err := compile(filepath.Join("..", ".."), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := proto.Clone(baseline).(*descriptorpb.FileDescriptorSet)
+			tt.change(current)
+
+			changes := check(baseline, current)
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.Kind)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, but got %v", tt.want, changes)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %v, but got %v", tt.want, changes)
+				}
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	changes := []breakingChange{{File: "api/proto/user/user.proto", Element: "user.UserService", Kind: rpcRemoved, Message: "rpc DeleteUser was removed"}}
+
+	var text bytes.Buffer
+	report(&text, "text", "baseline.binpb", changes)
+	want := "api/proto/user/user.proto: user.UserService: rpc DeleteUser was removed [rpc_removed]\n1 breaking change against baseline.binpb\n"
+	if text.String() != want {
+		t.Errorf("Expected %q, but got %q", want, text.String())
+	}
+
+	var doc struct {
+		Breaking []breakingChange `json:"breaking"`
+	}
+	var js bytes.Buffer
+	report(&js, "json", "baseline.binpb", changes)
+	if err := json.Unmarshal(js.Bytes(), &doc); err != nil || len(doc.Breaking) != 1 || doc.Breaking[0] != changes[0] {
+		t.Errorf("Expected the change in the JSON output, but got %s (%v)", js.String(), err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// compile compiles the protos of api/proto found under root, or the ones
+// of revision rev of the git repository at root when rev is set, like
+// `make compile-grpc` does with protoc.
+func compile(root, rev string) (*descriptorpb.FileDescriptorSet, error) {
+	var sources map[string][]byte
+	var err error
+	if rev == "" {
+		sources, err = readTree(root)
+	} else {
+		sources, err = readRevision(root, rev)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for name := range sources {
+		if strings.HasSuffix(name, ".proto") && !strings.HasPrefix(name, protoDir+"third_party/") {
+			files = append(files, name)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no protos under %s", protoDir)
+	}
+	slices.Sort(files)
+
+	compiler := protocompile.Compiler{
+		// the import paths of make compile-grpc
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{".", protoDir + "third_party"},
+			Accessor: func(name string) (io.ReadCloser, error) {
+				b, ok := sources[filepath.ToSlash(name)]
+				if !ok {
+					return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+				}
+				return io.NopCloser(bytes.NewReader(b)), nil
+			},
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range compiled {
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	return ours(set), nil
+}
+
+// readTree reads the files under api/proto in the working tree at root.
+func readTree(root string) (map[string][]byte, error) {
+	sources := map[string][]byte{}
+	dir := filepath.Join(root, protoDir)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		sources[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	return sources, err
+}
+
+// readRevision reads the files under api/proto at revision rev of the git
+// repository at root.
+func readRevision(root, rev string) (map[string][]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", root, "archive", "--format=tar", rev, "--", protoDir)
+	cmd.Stderr = &stderr
+	archive, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s at %s: %w: %s", protoDir, rev, err, strings.TrimSpace(stderr.String()))
+	}
+
+	sources := map[string][]byte{}
+	r := tar.NewReader(bytes.NewReader(archive))
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return sources, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		sources[path.Clean(h.Name)] = b
+	}
+}
+
+// generated checks that the code of pkg/grpc was generated from the protos
+// of set, so the servers built from it serve what the check looked at.
+func generated(set *descriptorpb.FileDescriptorSet) error {
+	var stale []string
+	for _, file := range set.GetFile() {
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(file.GetName())
+		if err != nil {
+			stale = append(stale, file.GetName())
+			continue
+		}
+		want, err := normalized(file)
+		if err != nil {
+			return err
+		}
+		got, err := normalized(protodesc.ToFileDescriptorProto(fd))
+		if err != nil {
+			return err
+		}
+		if !proto.Equal(want, got) {
+			stale = append(stale, file.GetName())
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("pkg/grpc is out of date with %s, run make compile-grpc", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// normalized strips what protoc and the generators may or may not keep
+// from a descriptor: source info and the JSON names of the fields. The
+// options are decoded again, the compiler holds custom ones like
+// google.api.http as dynamic messages the generated types never equal.
+func normalized(file *descriptorpb.FileDescriptorProto) (*descriptorpb.FileDescriptorProto, error) {
+	b, err := proto.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+	file = &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, file); err != nil {
+		return nil, err
+	}
+	file.SourceCodeInfo = nil
+	var strip func(m *descriptorpb.DescriptorProto)
+	strip = func(m *descriptorpb.DescriptorProto) {
+		for _, f := range m.GetField() {
+			f.JsonName = nil
+		}
+		for _, nested := range m.GetNestedType() {
+			strip(nested)
+		}
+	}
+	for _, m := range file.GetMessageType() {
+		strip(m)
+	}
+	return file, nil
+}
@@ -0,0 +1,187 @@
+// Command protocheck compares the protos of api/proto to a committed
+// baseline and reports the changes that break existing clients: removed or
+// renumbered fields, type changes, reserved numbers and names used again,
+// removed RPCs, etc.
+//
+//	protocheck [-baseline api/proto/baseline.binpb] [-current set.binpb] [-o text|json]
+//	protocheck -write-baseline [-rev v1.2.0]
+//
+// The current protos are compiled from api/proto, and the check fails when
+// the code of pkg/grpc wasn't generated from them: run `make compile-grpc`
+// after editing them. A descriptor set written by
+// `protoc --descriptor_set_out` can be checked instead with -current.
+//
+// The baseline holds the protos clients were built against. Once a change is
+// released, -write-baseline -rev <release> makes the protos of the release
+// the new baseline, without -rev it takes the ones of the working tree.
+//
+// The exit code is 0 without breaking changes, 1 with some, and 2 when the
+// check couldn't run.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	// registers the descriptors pkg/grpc was generated from
+	_ "go-learning/pkg/grpc/order"
+	_ "go-learning/pkg/grpc/product"
+	_ "go-learning/pkg/grpc/user"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	exitOK       = 0
+	exitBreaking = 1
+	exitError    = 2
+)
+
+// protoDir holds the protos of the services, the third party ones under it
+// are not checked.
+const protoDir = "api/proto/"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("protocheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baselinePath := fs.String("baseline", protoDir+"baseline.binpb", "descriptor set of the released protos")
+	currentPath := fs.String("current", "", "descriptor set of the protos to check, defaults to the ones of api/proto")
+	root := fs.String("root", ".", "root of the repository, api/proto is under it")
+	rev := fs.String("rev", "", "git revision to take the protos of api/proto from, defaults to the working tree")
+	format := fs.String("o", "text", "output format: text or json")
+	write := fs.Bool("write-baseline", false, "write the current protos to the baseline instead of checking them")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "error: unknown output format %q\n", *format)
+		return exitError
+	}
+
+	current, err := loadCurrent(*currentPath, *root, *rev)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	if *write {
+		if err := writeSet(*baselinePath, current); err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(stdout, "wrote %d files to %s\n", len(current.GetFile()), *baselinePath)
+		return exitOK
+	}
+	baseline, err := readSet(*baselinePath)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	changes := check(baseline, current)
+	if err := report(stdout, *format, *baselinePath, changes); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	if len(changes) > 0 {
+		return exitBreaking
+	}
+	return exitOK
+}
+
+// report prints the breaking changes, one per line or as a JSON document.
+func report(w io.Writer, format, baseline string, changes []breakingChange) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Baseline string           `json:"baseline"`
+			Breaking []breakingChange `json:"breaking"`
+		}{baseline, changes})
+	}
+
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+	}
+	switch len(changes) {
+	case 0:
+		_, err := fmt.Fprintf(w, "no breaking changes against %s\n", baseline)
+		return err
+	case 1:
+		_, err := fmt.Fprintf(w, "1 breaking change against %s\n", baseline)
+		return err
+	default:
+		_, err := fmt.Fprintf(w, "%d breaking changes against %s\n", len(changes), baseline)
+		return err
+	}
+}
+
+// loadCurrent reads the descriptor set at path, or compiles the protos of
+// api/proto when path is empty. Those of the working tree must be the ones
+// pkg/grpc was generated from.
+func loadCurrent(path, root, rev string) (*descriptorpb.FileDescriptorSet, error) {
+	if path != "" {
+		return readSet(path)
+	}
+	set, err := compile(root, rev)
+	if err != nil {
+		return nil, err
+	}
+	if rev == "" {
+		if err := generated(set); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// ours keeps the files under api/proto, sorted by path, as protoc also
+// writes the imports into a descriptor set with --include_imports.
+func ours(set *descriptorpb.FileDescriptorSet) *descriptorpb.FileDescriptorSet {
+	files := slices.DeleteFunc(slices.Clone(set.GetFile()), func(f *descriptorpb.FileDescriptorProto) bool {
+		return !strings.HasPrefix(f.GetName(), protoDir) || strings.HasPrefix(f.GetName(), protoDir+"third_party/")
+	})
+	slices.SortFunc(files, func(a, b *descriptorpb.FileDescriptorProto) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	return &descriptorpb.FileDescriptorSet{File: files}
+}
+
+func readSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("reading the descriptor set %s: %w", path, err)
+	}
+	return ours(set), nil
+}
+
+func writeSet(path string, set *descriptorpb.FileDescriptorSet) error {
+	// source info only holds comments and positions, which would make the
+	// baseline change with every comment
+	stripped := proto.Clone(set).(*descriptorpb.FileDescriptorSet)
+	for _, f := range stripped.GetFile() {
+		f.SourceCodeInfo = nil
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(stripped)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -3,12 +3,24 @@ package main
 import (
 	"context"
 	"fmt"
+	"go-learning/internal/admin"
 	"go-learning/internal/config"
+	"go-learning/internal/gateway"
+	"go-learning/internal/logging"
+	"go-learning/internal/middleware"
+	"go-learning/internal/orders"
+	"go-learning/internal/outbox"
 	"go-learning/internal/routers"
+	"go-learning/internal/services"
+	"go-learning/pkg/events"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -23,10 +35,16 @@ var (
 
 func main() {
 	config := config.LoadConfig()
+	logLevel := logging.Setup(config.LogLevel, config.LogFormat)
 
-	fmt.Println("Config:", config)
+	fmt.Println("Config:", config.Redacted())
+
+	// gin.Default would add its own text logger, we log through slog instead
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.AccessLog(config.AccessLog), gin.Recovery())
+	router.Use(middleware.SecurityHeaders(config.SecurityHeaders))
+	router.Use(middleware.Decompress(config.Compression), middleware.Compress(config.Compression))
 
-	router := gin.Default()
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "OK"})
 	})
@@ -44,9 +62,61 @@ func main() {
 		c.JSON(200, gin.H{"message": "Graceful response completed"})
 	})
 
+	// the API only serves JSON, so nothing should ever be loaded or framed from it
+	apiHeaders := config.SecurityHeaders
+	apiHeaders.ContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	pricing := orders.Pricing{TaxBasisPoints: config.Orders.TaxBasisPoints}
+
+	// both API versions publish their domain events to the same bus, the
+	// audit log is its first subscriber
+	bus := events.New(events.Options{})
+	if err := events.Subscribe(bus, "audit", events.Log(slog.Default()), events.SubscribeOptions{}); err != nil {
+		slog.Error("failed to subscribe the audit log", slog.String("error", err.Error()))
+	}
+
+	// both API versions are served in-process by the services of the gRPC
+	// server, over the same stores. They're journaled in their own
+	// directory under STORE_DIR, two processes can't share a journal.
+	storeConfig := config.Store
+	if storeConfig.Dir != "" {
+		storeConfig.Dir = filepath.Join(storeConfig.Dir, "rest")
+	}
+	stores, err := services.Open(storeConfig)
+	if err != nil {
+		slog.Error("failed to open the stores", slog.String("dir", storeConfig.Dir), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	// the API has no metrics endpoint, the relay doesn't register its own
+	stopRelay, err := outbox.Start(config.Outbox, stores.Outbox, bus, nil)
+	if err != nil {
+		slog.Error("failed to start the outbox relay", slog.String("file", config.Outbox.File), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	publish := services.WithEvents(bus)
+	userServer := services.NewUserServer(stores, config.Idempotency.Window, publish)
+	orderServer := services.NewOrderServer(stores, pricing, config.Idempotency.Window, publish)
+
 	apiV1 := router.Group("/api/v1")
 	{
-		routers.UserRouter(apiV1)
+		apiV1.Use(middleware.SecurityHeaders(apiHeaders))
+		middleware.EnableCORS(apiV1, config.CORS)
+
+		routers.UserRouter(apiV1, userServer, orderServer)
+		routers.OrderRouter(apiV1, orderServer)
+	}
+
+	// v2 is generated from the google.api.http annotations of the protos
+	gw := gateway.New()
+	userpb.RegisterUserServiceServer(gw, userServer)
+	orderpb.RegisterOrderServiceServer(gw, orderServer)
+	productpb.RegisterProductServiceServer(gw, services.NewProductServer(stores, publish))
+
+	apiV2 := router.Group("/api/v2")
+	{
+		apiV2.Use(middleware.SecurityHeaders(apiHeaders))
+		middleware.EnableCORS(apiV2, config.CORS)
+
+		routers.GatewayRouter(apiV2, gw)
 	}
 
 	server := &http.Server{
@@ -63,6 +133,30 @@ func main() {
 		}
 	}()
 
+	// The admin listener is private, it's only started when a token protects it
+	var adminServer *http.Server
+	if config.Admin.Token != "" {
+		adminServer = admin.NewServer(admin.Options{
+			Addr:   config.Admin.Addr,
+			Token:  config.Admin.Token,
+			Config: config.Redacted(),
+			Build: map[string]string{
+				"version":    Version,
+				"build_time": BuildTime,
+				"git_commit": GitCommit,
+			},
+			Level: logLevel,
+		})
+		go func() {
+			slog.Info("admin server started", slog.String("addr", adminServer.Addr))
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start admin server", slog.String("error", err.Error()))
+			}
+		}()
+	} else {
+		slog.Warn("ADMIN_TOKEN not set, admin server disabled")
+	}
+
 	// Create a channel to receive OS signals
 	quit := make(chan os.Signal, 1)
 	// Register the channel to receive specific signals
@@ -82,5 +176,23 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the events of the drained requests are handled before exiting
+	if err := stopRelay(ctx); err != nil {
+		slog.Error("outbox not fully relayed", slog.String("error", err.Error()))
+	}
+	if err := stores.Close(); err != nil {
+		slog.Error("failed to close the stores", slog.String("error", err.Error()))
+	}
+	if err := bus.Close(ctx); err != nil {
+		slog.Error("event bus forced to close", slog.String("error", err.Error()))
+	}
+
+	// The admin server goes last so it stays available while requests drain
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			slog.Error("admin server forced to shutdown", slog.String("error", err.Error()))
+		}
+	}
+
 	slog.Info("server exited gracefully")
 }
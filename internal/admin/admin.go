@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+)
+
+// Options configures the admin server.
+type Options struct {
+	Addr  string
+	Token string // required bearer token for every endpoint
+
+	// Config is served as JSON by /admin/config, it must already be redacted.
+	Config any
+	// Build is merged into the /admin/buildinfo response (version, commit...).
+	Build map[string]string
+	// Level is the live level of the default logger.
+	Level *slog.LevelVar
+}
+
+// NewServer returns the admin HTTP server. It is meant to listen on a
+// private address, separate from the public API, so profiling and
+// debugging endpoints are never reachable through the public listener.
+func NewServer(opts Options) *http.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("GET /admin/goroutines", goroutines)
+	mux.HandleFunc("GET /admin/runtime", runtimeStats)
+	mux.HandleFunc("GET /admin/buildinfo", buildInfo(opts.Build))
+	mux.HandleFunc("GET /admin/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, opts.Config)
+	})
+	mux.HandleFunc("GET /admin/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"level": opts.Level.Level().String()})
+	})
+	mux.HandleFunc("PUT /admin/loglevel", setLogLevel(opts.Level))
+
+	return &http.Server{
+		Addr:              opts.Addr,
+		Handler:           requireToken(opts.Token, mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// constant time comparison so the token can't be guessed byte by byte
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// debug=2 prints every goroutine with its full stack, like a panic does
+	_ = runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func runtimeStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"goroutines":     runtime.NumGoroutine(),
+		"cpus":           runtime.NumCPU(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"heap_alloc":     mem.HeapAlloc,
+		"heap_objects":   mem.HeapObjects,
+		"total_alloc":    mem.TotalAlloc,
+		"sys":            mem.Sys,
+		"num_gc":         mem.NumGC,
+		"gc_pause_total": time.Duration(mem.PauseTotalNs).String(),
+	})
+}
+
+func buildInfo(build map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := map[string]any{}
+		for k, v := range build {
+			info[k] = v
+		}
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			info["go_version"] = bi.GoVersion
+			info["path"] = bi.Path
+			settings := map[string]string{}
+			for _, s := range bi.Settings {
+				settings[s.Key] = s.Value
+			}
+			info["settings"] = settings
+		}
+		writeJSON(w, http.StatusOK, info)
+	}
+}
+
+func setLogLevel(levelVar *slog.LevelVar) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(body.Level)); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		previous := levelVar.Level()
+		levelVar.Set(level)
+		slog.Warn("log level changed", slog.String("from", previous.String()), slog.String("to", level.String()))
+
+		writeJSON(w, http.StatusOK, map[string]string{"level": level.String()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-learning/internal/config"
+)
+
+const token = "admin-token"
+
+func newHandler(t *testing.T, opts Options) http.Handler {
+	t.Helper()
+	opts.Token = token
+	if opts.Level == nil {
+		opts.Level = new(slog.LevelVar)
+	}
+	// the log level change is logged
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return NewServer(opts).Handler
+}
+
+func serve(handler http.Handler, method, path, authorization, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequireToken(t *testing.T) {
+	handler := newHandler(t, Options{})
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"missing token", "/admin/runtime", "", http.StatusUnauthorized},
+		{"wrong token", "/admin/runtime", "Bearer nope", http.StatusUnauthorized},
+		{"token prefix", "/admin/runtime", "Bearer " + token[:5], http.StatusUnauthorized},
+		{"not a bearer token", "/admin/runtime", token, http.StatusUnauthorized},
+		{"basic auth", "/admin/runtime", "Basic " + token, http.StatusUnauthorized},
+		{"pprof without token", "/debug/pprof/", "", http.StatusUnauthorized},
+		{"valid token", "/admin/runtime", "Bearer " + token, http.StatusOK},
+		{"pprof with token", "/debug/pprof/", "Bearer " + token, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(handler, http.MethodGet, tt.path, tt.authorization, "")
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, but got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantCode  int
+		wantLevel slog.Level
+	}{
+		{"debug", `{"level":"DEBUG"}`, http.StatusOK, slog.LevelDebug},
+		{"lower case", `{"level":"error"}`, http.StatusOK, slog.LevelError},
+		{"offset", `{"level":"WARN+2"}`, http.StatusOK, slog.LevelWarn + 2},
+		{"unknown level", `{"level":"LOUD"}`, http.StatusBadRequest, slog.LevelInfo},
+		{"invalid body", `level=DEBUG`, http.StatusBadRequest, slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level := new(slog.LevelVar)
+			handler := newHandler(t, Options{Level: level})
+
+			rec := serve(handler, http.MethodPut, "/admin/loglevel", "Bearer "+token, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Errorf("Expected status %d, but got %d: %s", tt.wantCode, rec.Code, rec.Body)
+			}
+			if level.Level() != tt.wantLevel {
+				t.Errorf("Expected level %s, but got %s", tt.wantLevel, level.Level())
+			}
+
+			rec = serve(handler, http.MethodGet, "/admin/loglevel", "Bearer "+token, "")
+			var got struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("Expected a JSON body, but got %v", err)
+			}
+			if got.Level != tt.wantLevel.String() {
+				t.Errorf("Expected GET to return %s, but got %s", tt.wantLevel, got.Level)
+			}
+		})
+	}
+}
+
+func TestLogLevelRequiresToken(t *testing.T) {
+	level := new(slog.LevelVar)
+	handler := newHandler(t, Options{Level: level})
+
+	rec := serve(handler, http.MethodPut, "/admin/loglevel", "Bearer nope", `{"level":"DEBUG"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, but got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if level.Level() != slog.LevelInfo {
+		t.Errorf("Expected the level to stay INFO, but got %s", level.Level())
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	var cfg config.Config
+	cfg.Port = 8080
+	cfg.Admin.Token = "admin-secret"
+	cfg.GRPC.AuthSecret = "hmac-secret"
+	handler := newHandler(t, Options{Config: cfg.Redacted()})
+
+	rec := serve(handler, http.MethodGet, "/admin/config", "Bearer "+token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, but got %d", http.StatusOK, rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, secret := range []string{"admin-secret", "hmac-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Expected %q to be redacted, but got %s", secret, body)
+		}
+	}
+	var got config.Config
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Expected the config as JSON, but got %v", err)
+	}
+	if got.Admin.Token != "REDACTED" || got.GRPC.AuthSecret != "REDACTED" {
+		t.Errorf("Expected the secrets to be REDACTED, but got %q and %q", got.Admin.Token, got.GRPC.AuthSecret)
+	}
+	if got.Port != 8080 {
+		t.Errorf("Expected the rest of the config, but got port %d", got.Port)
+	}
+}
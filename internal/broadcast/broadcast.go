@@ -0,0 +1,172 @@
+// Package broadcast is an in-process pub/sub where every event gets a
+// sequence number. Recent events are kept so a subscriber that reconnects
+// can resume where it left off, and subscribers that don't keep up are
+// dropped instead of slowing down publishers.
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrSequenceExpired means the events after the requested sequence are
+	// not kept anymore, the subscriber has to start over.
+	ErrSequenceExpired = errors.New("sequence is not retained anymore")
+	// ErrUnknownSequence means the requested sequence hasn't been published.
+	ErrUnknownSequence = errors.New("sequence has not been published yet")
+	// ErrSlowSubscriber ends a subscription whose buffer was full.
+	ErrSlowSubscriber = errors.New("subscriber too slow, events were dropped")
+	// ErrClosed ends the subscriptions of a closed broker.
+	ErrClosed = errors.New("broker closed")
+)
+
+// Event is a published value and its sequence number, starting at 1.
+type Event[T any] struct {
+	Seq   uint64
+	Value T
+}
+
+// Broker fans events out to subscribers. It is safe for concurrent use.
+type Broker[T any] struct {
+	mu      sync.Mutex
+	seq     uint64
+	history []Event[T] // the last retain events, oldest first
+	retain  int
+	buffer  int
+	subs    map[*Subscription[T]]struct{}
+	closed  bool
+}
+
+// New returns a broker keeping the last retain events for resuming, with
+// room for buffer pending events per subscriber.
+func New[T any](retain, buffer int) *Broker[T] {
+	return &Broker[T]{
+		retain: retain,
+		buffer: buffer,
+		subs:   make(map[*Subscription[T]]struct{}),
+	}
+}
+
+// Publish sends v to every matching subscriber and returns its sequence.
+// It never blocks: a subscriber with a full buffer is dropped with
+// ErrSlowSubscriber.
+func (b *Broker[T]) Publish(v T) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event[T]{Seq: b.seq, Value: v}
+	if b.retain > 0 {
+		if len(b.history) == b.retain {
+			// shift instead of reslicing, so the backing array doesn't grow forever
+			copy(b.history, b.history[1:])
+			b.history = b.history[:len(b.history)-1]
+		}
+		b.history = append(b.history, event)
+	}
+
+	for sub := range b.subs {
+		if !sub.match(v) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			b.end(sub, ErrSlowSubscriber)
+		}
+	}
+	return event.Seq
+}
+
+// Subscribe returns a subscription to the events matching match, nil
+// matches everything. With resume, the retained events published after
+// the given sequence are delivered first, 0 replays all of them.
+func (b *Broker[T]) Subscribe(match func(T) bool, after uint64, resume bool) (*Subscription[T], error) {
+	if match == nil {
+		match = func(T) bool { return true }
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	var backlog []Event[T]
+	if resume {
+		if after > b.seq {
+			return nil, fmt.Errorf("%w: %d, the last one is %d", ErrUnknownSequence, after, b.seq)
+		}
+		// the event right after the requested one must still be there
+		if after < b.seq && (len(b.history) == 0 || b.history[0].Seq > after+1) {
+			return nil, fmt.Errorf("%w: %d", ErrSequenceExpired, after)
+		}
+		for _, event := range b.history {
+			if event.Seq > after && match(event.Value) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	sub := &Subscription[T]{
+		broker: b,
+		match:  match,
+		events: make(chan Event[T], b.buffer+len(backlog)),
+	}
+	for _, event := range backlog {
+		sub.events <- event
+	}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close ends every subscription with ErrClosed.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.end(sub, ErrClosed)
+	}
+}
+
+// end removes a subscription and closes its channel, b.mu must be held.
+func (b *Broker[T]) end(sub *Subscription[T], err error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.events)
+}
+
+// Subscription receives the events of a broker until it is closed.
+type Subscription[T any] struct {
+	broker *Broker[T]
+	match  func(T) bool
+	events chan Event[T]
+	err    error // set before events is closed
+}
+
+// Events returns the channel of events. It is closed when the subscription
+// ends, Err tells why.
+func (s *Subscription[T]) Events() <-chan Event[T] {
+	return s.events
+}
+
+// Err returns why the subscription ended, once Events is closed. It is nil
+// when the subscriber closed it itself.
+func (s *Subscription[T]) Err() error {
+	return s.err
+}
+
+// Close unsubscribes, it is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.end(s, nil)
+}
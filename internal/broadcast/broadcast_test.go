@@ -0,0 +1,121 @@
+package broadcast
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// drain returns the values received until the channel is empty.
+func drain(sub *Subscription[int]) []int {
+	var values []int
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return values
+			}
+			values = append(values, event.Value)
+		default:
+			return values
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := New[int](10, 10)
+	even, _ := b.Subscribe(func(v int) bool { return v%2 == 0 }, 0, false)
+	all, _ := b.Subscribe(nil, 0, false)
+
+	for i := 1; i <= 4; i++ {
+		if seq := b.Publish(i); seq != uint64(i) {
+			t.Errorf("Expected sequence %d, but got %d", i, seq)
+		}
+	}
+
+	if got := drain(even); !slices.Equal(got, []int{2, 4}) {
+		t.Errorf("Expected [2 4], but got %v", got)
+	}
+	if got := drain(all); !slices.Equal(got, []int{1, 2, 3, 4}) {
+		t.Errorf("Expected [1 2 3 4], but got %v", got)
+	}
+}
+
+func TestResume(t *testing.T) {
+	b := New[int](3, 10)
+	for i := 1; i <= 5; i++ {
+		b.Publish(i)
+	}
+
+	tests := []struct {
+		name    string
+		after   uint64
+		want    []int
+		wantErr error
+	}{
+		{"after retained event", 3, []int{4, 5}, nil},
+		{"right before the oldest", 2, []int{3, 4, 5}, nil},
+		{"up to date", 5, nil, nil},
+		{"expired", 1, nil, ErrSequenceExpired},
+		{"from the start", 0, nil, ErrSequenceExpired},
+		{"future", 6, nil, ErrUnknownSequence},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := b.Subscribe(nil, tt.after, true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, but got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer sub.Close()
+			if got := drain(sub); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := New[int](10, 2)
+	slow, _ := b.Subscribe(nil, 0, false)
+	fast, _ := b.Subscribe(nil, 0, false)
+
+	for i := 1; i <= 3; i++ {
+		b.Publish(i)
+		if i < 3 {
+			<-fast.Events()
+		}
+	}
+
+	if got := drain(slow); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("Expected the events buffered before the drop, but got %v", got)
+	}
+	if !errors.Is(slow.Err(), ErrSlowSubscriber) {
+		t.Errorf("Expected ErrSlowSubscriber, but got %v", slow.Err())
+	}
+	if got := drain(fast); !slices.Equal(got, []int{3}) {
+		t.Errorf("Expected the fast subscriber to keep receiving, but got %v", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := New[int](10, 2)
+	sub, _ := b.Subscribe(nil, 0, false)
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.Events(); ok || sub.Err() != nil {
+		t.Errorf("Expected a closed subscription without error, but got %v", sub.Err())
+	}
+
+	other, _ := b.Subscribe(nil, 0, false)
+	b.Close()
+	if _, ok := <-other.Events(); ok || !errors.Is(other.Err(), ErrClosed) {
+		t.Errorf("Expected ErrClosed, but got %v", other.Err())
+	}
+	if _, err := b.Subscribe(nil, 0, false); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed for a new subscriber, but got %v", err)
+	}
+}
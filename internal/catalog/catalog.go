@@ -0,0 +1,45 @@
+package catalog
+
+import (
+	"errors"
+
+	"go-learning/internal/money"
+	"go-learning/internal/validation"
+)
+
+var (
+	ErrMissingSKU    = errors.New("sku is required")
+	ErrMissingName   = errors.New("name is required")
+	ErrInvalidPrice  = errors.New("price must be positive")
+	ErrNegativeStock = errors.New("stock must not be negative")
+)
+
+// Product is an item of the catalog, orders are priced from it.
+type Product struct {
+	ID    string      `json:"id" yaml:"id"`
+	SKU   string      `json:"sku" yaml:"sku"`
+	Name  string      `json:"name" yaml:"name"`
+	Price money.Money `json:"price" yaml:"price"`
+	Stock int64       `json:"stock" yaml:"stock"`
+}
+
+// Validate reports every invalid field of the product at once.
+func (p Product) Validate() error {
+	var errs []error
+	if p.SKU == "" {
+		errs = append(errs, validation.Field("sku", ErrMissingSKU))
+	}
+	if p.Name == "" {
+		errs = append(errs, validation.Field("name", ErrMissingName))
+	}
+	if p.Price.Amount <= 0 {
+		errs = append(errs, validation.Field("price.amount", ErrInvalidPrice))
+	}
+	if !money.ValidCurrency(p.Price.Currency) {
+		errs = append(errs, validation.Field("price.currency", money.ErrInvalidCurrency))
+	}
+	if p.Stock < 0 {
+		errs = append(errs, validation.Field("stock", ErrNegativeStock))
+	}
+	return errors.Join(errs...)
+}
@@ -4,12 +4,143 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port int
+	Port            int
+	CORS            CORSConfig
+	SecurityHeaders SecurityHeadersConfig
+	Compression     CompressionConfig
+	LogLevel        string
+	LogFormat       string // "text" or "json"
+	AccessLog       AccessLogConfig
+	Admin           AdminConfig
+	GRPC            GRPCConfig
+	Orders          OrdersConfig
+	Idempotency     IdempotencyConfig
+	Store           StoreConfig
+	Outbox          OutboxConfig
+}
+
+// CORSConfig controls which browser origins may call the API.
+// Origins may contain a single "*" wildcard, e.g. "https://*.example.com".
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache a preflight response
+}
+
+// SecurityHeadersConfig holds the values of the response security headers.
+// An empty value disables the corresponding header.
+type SecurityHeadersConfig struct {
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ContentTypeNosniff    bool
+}
+
+// CompressionConfig controls gzip/zstd compression of response bodies and
+// decompression of request bodies.
+type CompressionConfig struct {
+	MinSize             int   // responses smaller than this are sent uncompressed
+	MaxRequestBodyBytes int64 // limit for a decompressed request body
+}
+
+// AccessLogConfig controls which requests end up in the access log.
+// Errors and slow requests are always logged, successful ones are sampled.
+type AccessLogConfig struct {
+	SampleRate    float64       // fraction of 2xx/3xx requests to log, 0 to 1
+	SlowThreshold time.Duration // requests slower than this are always logged
+	RedactParams  []string      // path and query parameters whose value is hidden
+}
+
+// AdminConfig configures the admin listener (pprof, runtime stats, log level).
+// The listener is only started when a token is set.
+type AdminConfig struct {
+	Addr  string
+	Token string
+}
+
+// GRPCConfig configures the gRPC server.
+type GRPCConfig struct {
+	Addr string
+	// TLSCertFile and TLSKeyFile enable TLS, the server is plaintext without them.
+	TLSCertFile string
+	TLSKeyFile  string
+	Keepalive   KeepaliveConfig
+	// MaxRecvMsgSize and MaxSendMsgSize limit message sizes in bytes,
+	// 0 keeps the gRPC defaults (4MB received, unlimited sent).
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+	// Compression is "gzip" to compress replies for clients that accept it,
+	// or empty. Compressed requests are always accepted.
+	Compression string
+	// ShutdownTimeout bounds the graceful stop, the RPCs still running
+	// afterwards are cancelled.
+	ShutdownTimeout time.Duration
+
+	// LegacyResponseStatus makes failed RPCs succeed with the error in the
+	// reply's common.ResponseStatus, for clients that predate status codes.
+	LegacyResponseStatus bool
+	// AuthSecret signs the JWT bearer tokens, auth is disabled without it.
+	AuthSecret string
+	// PublicMethods can be called without a token, e.g.
+	// "/user.UserService/GetUser" or "/grpc.health.v1.Health/*".
+	PublicMethods []string
+	// MetricsAddr serves the Prometheus /metrics endpoint, empty disables it.
+	MetricsAddr string
+}
+
+// KeepaliveConfig controls the pings on idle connections and how long
+// connections may live. A zero duration keeps the gRPC default.
+type KeepaliveConfig struct {
+	Time              time.Duration // ping a client after this long without activity
+	Timeout           time.Duration // close the connection if the ping isn't answered
+	MaxConnectionIdle time.Duration
+	MaxConnectionAge  time.Duration
+	// MinTime is the minimum interval between client pings, clients pinging
+	// more often are disconnected.
+	MinTime             time.Duration
+	PermitWithoutStream bool
+}
+
+// OrdersConfig holds the pricing rules shared by both APIs.
+type OrdersConfig struct {
+	TaxBasisPoints int64 // 1600 is a 16% tax
+}
+
+// IdempotencyConfig controls how long the replies of create requests
+// carrying a request_id are remembered, so retries don't create duplicates.
+type IdempotencyConfig struct {
+	Window time.Duration // 0 disables the deduplication
+}
+
+// StoreConfig controls where the servers keep their users, products and
+// orders. Without a directory they only live in memory.
+type StoreConfig struct {
+	Dir string
+	// Sync is "always" to fsync every change before replying, "interval"
+	// to fsync every SyncInterval, or "never" to leave it to the OS.
+	Sync             string
+	SyncInterval     time.Duration
+	SnapshotInterval time.Duration // how often the journal is compacted
+}
+
+// OutboxConfig controls the relay publishing the order events written to
+// the outbox. They always go to the in-process event bus.
+type OutboxConfig struct {
+	// File also appends them to a newline-delimited JSON file, empty
+	// disables it.
+	File     string
+	Interval time.Duration // how often the outbox is polled and failures retried
 }
 
 func LoadConfig() Config {
@@ -31,5 +162,162 @@ func LoadConfig() Config {
 
 	return Config{
 		Port: port,
+		CORS: CORSConfig{
+			AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", nil),
+			AllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+			AllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type"}),
+			ExposedHeaders:   getEnvList("CORS_EXPOSED_HEADERS", nil),
+			AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+		},
+		SecurityHeaders: SecurityHeadersConfig{
+			HSTSMaxAge:            getEnvDuration("SECURITY_HSTS_MAX_AGE", 365*24*time.Hour),
+			HSTSIncludeSubdomains: getEnvBool("SECURITY_HSTS_INCLUDE_SUBDOMAINS", true),
+			ContentSecurityPolicy: getEnv("SECURITY_CSP", "default-src 'self'"),
+			FrameOptions:          getEnv("SECURITY_FRAME_OPTIONS", "DENY"),
+			ContentTypeNosniff:    getEnvBool("SECURITY_CONTENT_TYPE_NOSNIFF", true),
+		},
+		Compression: CompressionConfig{
+			MinSize:             getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+			MaxRequestBodyBytes: int64(getEnvInt("MAX_REQUEST_BODY_BYTES", 10<<20)),
+		},
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
+		LogFormat: getEnv("LOG_FORMAT", "text"),
+		AccessLog: AccessLogConfig{
+			SampleRate:    getEnvFloat("ACCESS_LOG_SAMPLE_RATE", 1),
+			SlowThreshold: getEnvDuration("ACCESS_LOG_SLOW_THRESHOLD", time.Second),
+			RedactParams:  getEnvList("ACCESS_LOG_REDACT_PARAMS", []string{"token", "password", "secret", "api_key", "email"}),
+		},
+		Admin: AdminConfig{
+			Addr:  getEnv("ADMIN_ADDR", "localhost:6060"),
+			Token: os.Getenv("ADMIN_TOKEN"),
+		},
+		GRPC: GRPCConfig{
+			Addr:        getEnv("GRPC_ADDR", ":50051"),
+			TLSCertFile: os.Getenv("GRPC_TLS_CERT_FILE"),
+			TLSKeyFile:  os.Getenv("GRPC_TLS_KEY_FILE"),
+			Keepalive: KeepaliveConfig{
+				Time:                getEnvDuration("GRPC_KEEPALIVE_TIME", 2*time.Hour),
+				Timeout:             getEnvDuration("GRPC_KEEPALIVE_TIMEOUT", 20*time.Second),
+				MaxConnectionIdle:   getEnvDuration("GRPC_MAX_CONNECTION_IDLE", 0),
+				MaxConnectionAge:    getEnvDuration("GRPC_MAX_CONNECTION_AGE", 0),
+				MinTime:             getEnvDuration("GRPC_KEEPALIVE_MIN_TIME", 5*time.Minute),
+				PermitWithoutStream: getEnvBool("GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM", false),
+			},
+			MaxRecvMsgSize:       getEnvInt("GRPC_MAX_RECV_MSG_BYTES", 0),
+			MaxSendMsgSize:       getEnvInt("GRPC_MAX_SEND_MSG_BYTES", 0),
+			Compression:          getEnv("GRPC_COMPRESSION", ""),
+			ShutdownTimeout:      getEnvDuration("GRPC_SHUTDOWN_TIMEOUT", 30*time.Second),
+			LegacyResponseStatus: getEnvBool("GRPC_LEGACY_RESPONSE_STATUS", false),
+			AuthSecret:           os.Getenv("GRPC_AUTH_SECRET"),
+			PublicMethods:        getEnvList("GRPC_PUBLIC_METHODS", nil),
+			MetricsAddr:          getEnv("GRPC_METRICS_ADDR", "localhost:9090"),
+		},
+		Orders: OrdersConfig{
+			TaxBasisPoints: int64(getEnvInt("ORDER_TAX_BASIS_POINTS", 0)),
+		},
+		Idempotency: IdempotencyConfig{
+			Window: getEnvDuration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+		},
+		Store: StoreConfig{
+			Dir:              os.Getenv("STORE_DIR"),
+			Sync:             getEnv("STORE_SYNC", "always"),
+			SyncInterval:     getEnvDuration("STORE_SYNC_INTERVAL", 100*time.Millisecond),
+			SnapshotInterval: getEnvDuration("STORE_SNAPSHOT_INTERVAL", 5*time.Minute),
+		},
+		Outbox: OutboxConfig{
+			File:     os.Getenv("OUTBOX_FILE"),
+			Interval: getEnvDuration("OUTBOX_INTERVAL", time.Second),
+		},
+	}
+}
+
+// Redacted returns a copy of the config that is safe to print or expose.
+func (c Config) Redacted() Config {
+	if c.Admin.Token != "" {
+		c.Admin.Token = "REDACTED"
+	}
+	if c.GRPC.AuthSecret != "" {
+		c.GRPC.AuthSecret = "REDACTED"
+	}
+	return c
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList reads a comma separated list, e.g. "GET, POST".
+func getEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Error converting %s to int: %v, using default %v", key, err, fallback)
+		return fallback
+	}
+	return i
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Error converting %s to float: %v, using default %v", key, err, fallback)
+		return fallback
+	}
+	return f
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Error parsing %s as bool: %v, using default %v", key, err, fallback)
+		return fallback
+	}
+	return b
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Error parsing %s as duration: %v, using default %v", key, err, fallback)
+		return fallback
 	}
+	return d
 }
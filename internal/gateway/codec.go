@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	// field names match the proto files, like the rest of the REST API
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	unmarshalOptions = protojson.UnmarshalOptions{}
+)
+
+// mergeParams sets path and query parameters on the request. They go
+// through protojson like the body, so "3" is a valid int64 and
+// "name,email" a valid FieldMask. Unknown parameters are ignored.
+func mergeParams(req proto.Message, params map[string][]string) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	fields := req.ProtoReflect().Descriptor().Fields()
+	object := make(map[string]any, len(params))
+	for name, values := range params {
+		fd := fields.ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = fields.ByJSONName(name)
+		}
+		if fd == nil || fd.IsMap() || len(values) == 0 {
+			continue
+		}
+
+		jsonValues := make([]any, len(values))
+		for i, value := range values {
+			jsonValues[i] = value
+			if fd.Kind() == protoreflect.BoolKind {
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					return status.Errorf(codes.InvalidArgument, "invalid value for %s: %q", name, value)
+				}
+				jsonValues[i] = b
+			}
+		}
+		if fd.IsList() {
+			object[string(fd.Name())] = jsonValues
+		} else {
+			object[string(fd.Name())] = jsonValues[len(jsonValues)-1]
+		}
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	fromParams := req.ProtoReflect().New().Interface()
+	if err := unmarshalOptions.Unmarshal(data, fromParams); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid parameters: %v", err)
+	}
+	proto.Merge(req, fromParams)
+	return nil
+}
+
+// writeError sends the google.rpc.Status of err, details included, with
+// the HTTP status matching its code.
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	writeMessage(w, HTTPStatusFromCode(st.Code()), st.Proto())
+}
+
+func writeMessage(w http.ResponseWriter, code int, msg proto.Message) {
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		slog.Error("failed to marshal gateway response", slog.String("error", err.Error()))
+		http.Error(w, `{"code":13,"message":"internal error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// HTTPStatusFromCode maps gRPC codes to HTTP status codes.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		// 412 is for HTTP conditional headers, not the state of a resource
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,218 @@
+// Package gateway serves gRPC services as REST/JSON, following the
+// google.api.http annotations of their protos. Services are registered like
+// on a grpc.Server and called in-process, so the REST API is generated from
+// the protos instead of being maintained next to them.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// forwardedHeaders are passed to the services as incoming metadata.
+var forwardedHeaders = []string{"Authorization", "X-Request-ID", "User-Agent"}
+
+// pathParam matches a "{field}" in a path template. Only top level fields
+// are supported, they map one to one to http.ServeMux wildcards.
+var pathParam = regexp.MustCompile(`\{([^}]*)\}`)
+
+// Gateway is an http.Handler serving the annotated methods of the
+// registered services.
+type Gateway struct {
+	mux         *http.ServeMux
+	interceptor grpc.UnaryServerInterceptor
+}
+
+// New returns an empty gateway. The interceptors run around every call, as
+// they would on a grpc.Server.
+func New(interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	return &Gateway{
+		mux:         http.NewServeMux(),
+		interceptor: chainUnary(interceptors),
+	}
+}
+
+// RegisterService implements grpc.ServiceRegistrar, so the generated
+// Register*ServiceServer functions work with a Gateway. Methods without an
+// http annotation are not exposed. Like grpc.Server, it panics on a
+// service it can't serve.
+func (g *Gateway) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(desc.ServiceName))
+	if err != nil {
+		panic(fmt.Sprintf("gateway: service %s: %v", desc.ServiceName, err))
+	}
+	service := d.(protoreflect.ServiceDescriptor)
+
+	for _, method := range desc.Methods {
+		md := service.Methods().ByName(protoreflect.Name(method.MethodName))
+		if md == nil || !proto.HasExtension(md.Options(), annotations.E_Http) {
+			continue
+		}
+		rule := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+
+		for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+			r, err := newRoute(impl, method.Handler, g.interceptor, md, binding)
+			if err != nil {
+				panic(fmt.Sprintf("gateway: %s.%s: %v", desc.ServiceName, method.MethodName, err))
+			}
+			g.mux.Handle(r.pattern, r)
+		}
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// route serves one http binding of a method.
+type route struct {
+	impl        any
+	handler     grpc.MethodHandler
+	interceptor grpc.UnaryServerInterceptor
+	pattern     string
+	pathParams  []string
+	body        protoreflect.FieldDescriptor // nil for no body or "*"
+	wholeBody   bool
+	response    protoreflect.FieldDescriptor // nil for the whole reply
+}
+
+func newRoute(impl any, handler grpc.MethodHandler, interceptor grpc.UnaryServerInterceptor, md protoreflect.MethodDescriptor, rule *annotations.HttpRule) (*route, error) {
+	var verb, path string
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		verb, path = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		verb, path = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		verb, path = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		verb, path = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		verb, path = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		verb, path = p.Custom.GetKind(), p.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("missing http pattern")
+	}
+
+	r := &route{
+		impl:        impl,
+		handler:     handler,
+		interceptor: interceptor,
+		pattern:     verb + " " + path,
+	}
+
+	input := md.Input().Fields()
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		if input.ByName(protoreflect.Name(match[1])) == nil {
+			return nil, fmt.Errorf("path %q: %s is not a top level field of %s", path, match[1], md.Input().FullName())
+		}
+		r.pathParams = append(r.pathParams, match[1])
+	}
+
+	switch body := rule.GetBody(); body {
+	case "":
+	case "*":
+		r.wholeBody = true
+	default:
+		r.body = input.ByName(protoreflect.Name(body))
+		if r.body == nil || r.body.Message() == nil || r.body.IsList() {
+			return nil, fmt.Errorf("body %q is not a message field of %s", body, md.Input().FullName())
+		}
+	}
+
+	if name := rule.GetResponseBody(); name != "" {
+		r.response = md.Output().Fields().ByName(protoreflect.Name(name))
+		if r.response == nil || r.response.Message() == nil || r.response.IsList() {
+			return nil, fmt.Errorf("response_body %q is not a message field of %s", name, md.Output().FullName())
+		}
+	}
+	return r, nil
+}
+
+func (rt *route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	md := metadata.MD{}
+	for _, name := range forwardedHeaders {
+		if values := r.Header.Values(name); len(values) > 0 {
+			md.Set(name, values...)
+		}
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+
+	dec := func(v any) error {
+		return rt.decode(r, v.(proto.Message))
+	}
+	resp, err := rt.handler(rt.impl, ctx, dec, rt.interceptor)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	reply := resp.(proto.Message)
+	if rt.response != nil {
+		reply = reply.ProtoReflect().Get(rt.response).Message().Interface()
+	}
+	writeMessage(w, http.StatusOK, reply)
+}
+
+// decode fills the request from the body, the path and the query string.
+// Path parameters win over the body, the query string is only read for the
+// fields that don't come from the body.
+func (rt *route) decode(r *http.Request, req proto.Message) error {
+	if rt.wholeBody || rt.body != nil {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "reading body: %v", err)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			target := req
+			if rt.body != nil {
+				target = req.ProtoReflect().Mutable(rt.body).Message().Interface()
+			}
+			if err := unmarshalOptions.Unmarshal(data, target); err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid body: %v", err)
+			}
+		}
+	}
+
+	params := map[string][]string{}
+	if !rt.wholeBody {
+		for name, values := range r.URL.Query() {
+			params[name] = values
+		}
+	}
+	for _, name := range rt.pathParams {
+		params[name] = []string{r.PathValue(name)}
+	}
+	return mergeParams(req, params)
+}
+
+// chainUnary combines interceptors into one, the first is the outermost.
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	if len(interceptors) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, req any) (any, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
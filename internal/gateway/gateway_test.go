@@ -0,0 +1,140 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning/internal/gateway"
+	"go-learning/internal/services"
+	userpb "go-learning/pkg/grpc/user"
+	"go-learning/pkg/id"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func newTestGateway(t *testing.T, interceptors ...grpc.UnaryServerInterceptor) *gateway.Gateway {
+	t.Helper()
+	gw := gateway.New(interceptors...)
+	userpb.RegisterUserServiceServer(gw, services.NewUserServer(services.NewStores(), time.Minute))
+	return gw
+}
+
+func serve(gw http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestGateway(t *testing.T) {
+	gw := newTestGateway(t)
+
+	rec := serve(gw, http.MethodPost, "/api/v2/users", `{"name":"Ana","email":"ana@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %v: %s", rec.Code, rec.Body)
+	}
+	var created userpb.CreateUserReply
+	if err := protojson.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Expected a CreateUserReply, but got %v", err)
+	}
+
+	// path parameter plus a body with a FieldMask in its JSON form
+	rec = serve(gw, http.MethodPatch, "/api/v2/users/"+created.GetId(), `{"name":"ignored","email":"ana@example.org","update_mask":"email"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %v: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(gw, http.MethodGet, "/api/v2/users/"+created.GetId(), "")
+	var user userpb.GetUserReply
+	if err := protojson.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatalf("Expected a GetUserReply, but got %v", err)
+	}
+	if user.GetName() != "Ana" || user.GetEmail() != "ana@example.org" {
+		t.Errorf("Expected only the email to be updated, but got %v", &user)
+	}
+
+	// query parameters fill the requests without a body
+	rec = serve(gw, http.MethodGet, "/api/v2/users?page_size=1", "")
+	if !strings.Contains(rec.Body.String(), `"next_page_token"`) {
+		t.Errorf("Expected proto field names in the response, but got %s", rec.Body)
+	}
+}
+
+func TestGatewayErrors(t *testing.T) {
+	gw := newTestGateway(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"not found", http.MethodGet, "/api/v2/users/" + id.New(id.User), "", http.StatusNotFound, "google.rpc.ResourceInfo"},
+		{"malformed id", http.MethodGet, "/api/v2/users/missing", "", http.StatusBadRequest, "google.rpc.BadRequest"},
+		{"invalid body", http.MethodPost, "/api/v2/users", `{"unknown":1}`, http.StatusBadRequest, "invalid body"},
+		{"invalid query", http.MethodGet, "/api/v2/users?page_size=abc", "", http.StatusBadRequest, "invalid parameters"},
+		{"no route", http.MethodGet, "/api/v2/nothing", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(gw, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Errorf("Expected status %v, but got %v", tt.wantCode, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("Expected %q in the body, but got %s", tt.wantBody, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.OK, http.StatusOK},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		// like grpc-gateway, 412 is left to HTTP conditional headers
+		{codes.FailedPrecondition, http.StatusBadRequest},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.Unknown, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := gateway.HTTPStatusFromCode(tt.code); got != tt.want {
+			t.Errorf("Expected %v for %v, but got %v", tt.want, tt.code, got)
+		}
+	}
+}
+
+func TestGatewayInterceptors(t *testing.T) {
+	var method, authorization string
+	gw := newTestGateway(t, func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		method = info.FullMethod
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization = strings.Join(md.Get("authorization"), "")
+		return handler(ctx, req)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/users", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	gw.ServeHTTP(httptest.NewRecorder(), req)
+
+	if method != userpb.UserService_ListUsers_FullMethodName {
+		t.Errorf("Expected the interceptor to see %s, but got %q", userpb.UserService_ListUsers_FullMethodName, method)
+	}
+	if authorization != "Bearer token" {
+		t.Errorf("Expected the Authorization header as metadata, but got %q", authorization)
+	}
+}
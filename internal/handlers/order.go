@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	orderpb "go-learning/pkg/grpc/order"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The order handlers serve the v1 routes over the OrderService, so orders
+// are priced and their stock reserved from the catalog the ProductService
+// manages, and the service records their events in the outbox.
+
+// CreateOrder places an order and replies with it.
+func CreateOrder(orders orderpb.OrderServiceServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slog.Info("creating an order")
+
+		// same payload as the gRPC CreateOrder, in any supported format
+		var req orderpb.CreateOrderRequest
+		if err := c.ShouldBind(&req); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		created, err := orders.CreateOrder(c.Request.Context(), &req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		order, err := orders.GetOrder(c.Request.Context(), &orderpb.GetOrderRequest{Id: created.GetId()})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, http.StatusCreated, order)
+	}
+}
+
+func GetOrder(orders orderpb.OrderServiceServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("id")
+		slog.Info("getting an order", slog.String("id", orderID))
+
+		order, err := orders.GetOrder(c.Request.Context(), &orderpb.GetOrderRequest{Id: orderID})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, order)
+	}
+}
+
+// ListOrders lists the orders of the user given in the user_id query parameter.
+func ListOrders(orders orderpb.OrderServiceServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Query("user_id")
+		if userID == "" {
+			respond(c, http.StatusBadRequest, gin.H{"error": "user_id query parameter is required"})
+			return
+		}
+		listUserOrders(c, orders, userID)
+	}
+}
+
+// GetUserOrders lists the orders of the user in the path.
+func GetUserOrders(orders orderpb.OrderServiceServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listUserOrders(c, orders, c.Param("id"))
+	}
+}
+
+// CancelOrder cancels an order, its stock is given back.
+func CancelOrder(orders orderpb.OrderServiceServer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("id")
+		slog.Info("cancelling an order", slog.String("id", orderID))
+
+		order, err := orders.CancelOrder(c.Request.Context(), &orderpb.CancelOrderRequest{Id: orderID})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, order)
+	}
+}
+
+func listUserOrders(c *gin.Context, orders orderpb.OrderServiceServer, userID string) {
+	slog.Info("getting orders of a user", slog.String("user_id", userID))
+
+	reply, err := orders.ListOrdersByUser(c.Request.Context(), &orderpb.ListOrdersByUserRequest{UserId: userID})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, reply)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"go-learning/internal/gateway"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// offeredFormats lists the response formats in order of preference,
+// the first one is used when the client sends no Accept header.
+var offeredFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+	binding.MIMEYAML,
+	binding.MIMEYAML2,
+	binding.MIMEPROTOBUF,
+}
+
+// protoJSON is how proto messages look in the other formats: the field
+// names of the protos, enums by name, and every field, zeros included.
+var protoJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// respond writes data in the format negotiated from the Accept header.
+// Protobuf is only possible for proto messages, error bodies fall back to
+// JSON in that case so the client still gets a readable error.
+func respond(c *gin.Context, code int, data any) {
+	format := c.NegotiateFormat(offeredFormats...)
+	if m, ok := data.(proto.Message); ok && format != binding.MIMEPROTOBUF {
+		// the JSON tags of the generated structs don't follow protojson
+		body, err := plain(m)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data = body
+	}
+
+	switch format {
+	case binding.MIMEJSON:
+		c.JSON(code, data)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(code, render.MsgPack{Data: data})
+	case binding.MIMEYAML, binding.MIMEYAML2:
+		c.YAML(code, data)
+	case binding.MIMEPROTOBUF:
+		if _, ok := data.(proto.Message); ok {
+			c.ProtoBuf(code, data)
+			return
+		}
+		if code >= http.StatusBadRequest {
+			c.JSON(code, data)
+			return
+		}
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "resource has no protobuf representation"})
+	default:
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "the accepted formats are not offered by the server"})
+	}
+}
+
+// respondError writes the error of a service call with the HTTP status the
+// gateway uses for its code. The details, field violations included, tell
+// the client what to fix.
+func respondError(c *gin.Context, err error) {
+	st := status.Convert(err)
+	body := gin.H{"error": st.Message()}
+	if details := st.Proto().GetDetails(); len(details) > 0 {
+		rendered := make([]any, 0, len(details))
+		for _, detail := range details {
+			v, err := plain(detail)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			rendered = append(rendered, v)
+		}
+		body["details"] = rendered
+	}
+	respond(c, gateway.HTTPStatusFromCode(st.Code()), body)
+}
+
+// plain returns the protojson form of m as maps and slices, so every
+// format renders it alike. The common.ResponseStatus fields are left out,
+// the HTTP status already says how the request went.
+func plain(m proto.Message) (any, error) {
+	b, err := protoJSON.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// keeps the numbers as protojson wrote them
+	dec.UseNumber()
+	var v map[string]any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	dropStatus(m.ProtoReflect().Descriptor(), v)
+	return v, nil
+}
+
+func dropStatus(md protoreflect.MessageDescriptor, v map[string]any) {
+	fields := md.Fields()
+	for i := range fields.Len() {
+		field := fields.Get(i)
+		if field.Message() == nil || field.IsMap() {
+			continue
+		}
+		name := string(field.Name())
+		if field.Message().FullName() == "common.ResponseStatus" {
+			delete(v, name)
+			continue
+		}
+		switch value := v[name].(type) {
+		case map[string]any:
+			dropStatus(field.Message(), value)
+		case []any:
+			for _, item := range value {
+				if item, ok := item.(map[string]any); ok {
+					dropStatus(field.Message(), item)
+				}
+			}
+		}
+	}
+}
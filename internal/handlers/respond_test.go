@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-learning/pkg/grpc/common"
+	userpb "go-learning/pkg/grpc/user"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRespondProto(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/user", func(c *gin.Context) {
+		respond(c, http.StatusOK, &userpb.GetUserReply{
+			Id:     "1",
+			Name:   "Jane",
+			Status: &common.ResponseStatus{Code: 200, Message: "OK"},
+		})
+	})
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"application/json", `{"email":"","id":"1","name":"Jane"}`},
+		{"application/yaml", "email: \"\"\nid: \"1\"\nname: Jane\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, but got %d", http.StatusOK, rec.Code)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != strings.TrimSpace(tt.want) {
+				t.Errorf("Expected %q, but got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("application/x-protobuf", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req.Header.Set("Accept", "application/x-protobuf")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		var user userpb.GetUserReply
+		if err := proto.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+			t.Fatalf("Expected a protobuf body, but got %v", err)
+		}
+		// protobuf clients get the whole message
+		if user.GetName() != "Jane" || user.GetStatus().GetCode() != 200 {
+			t.Errorf("Expected the user with its status, but got %v", &user)
+		}
+	})
+}
+
+func TestRespondErrorDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/order", func(c *gin.Context) {
+		st, _ := status.New(codes.InvalidArgument, "invalid request").WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "user_id", Description: "is required"}},
+		})
+		respondError(c, st.Err())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/order", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, but got %d", http.StatusBadRequest, rec.Code)
+	}
+	var body struct {
+		Error   string `json:"error"`
+		Details []struct {
+			Type            string `json:"@type"`
+			FieldViolations []struct {
+				Field       string `json:"field"`
+				Description string `json:"description"`
+			} `json:"field_violations"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body, but got %v", err)
+	}
+	if body.Error != "invalid request" {
+		t.Errorf("Expected the status message, but got %q", body.Error)
+	}
+	if len(body.Details) != 1 || len(body.Details[0].FieldViolations) != 1 || body.Details[0].FieldViolations[0].Field != "user_id" {
+		t.Errorf("Expected the field violation in the details, but got %s", rec.Body)
+	}
+}
@@ -5,40 +5,86 @@ import (
 	"net/http"
 	"strconv"
 
+	userpb "go-learning/pkg/grpc/user"
+
 	"github.com/gin-gonic/gin"
 )
 
-var users = []string{"John", "Jane", "Jim", "Jill"}
+// The user handlers serve the v1 routes over the UserService, so they
+// share its store and rules with the gRPC server and /api/v2. Replies are
+// the gRPC messages, so every format, protobuf included, shares a single
+// representation.
 
-func GetList() gin.HandlerFunc {
+// GetList pages through the users like ListUsers, the page_size,
+// page_token, name_contains and email_contains query parameters are its
+// fields.
+func GetList(users userpb.UserServiceServer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		slog.Info("getting all users")
 
-		c.JSON(http.StatusOK, users)
+		req := &userpb.ListUsersRequest{
+			PageToken:     c.Query("page_token"),
+			NameContains:  c.Query("name_contains"),
+			EmailContains: c.Query("email_contains"),
+		}
+		if pageSize := c.Query("page_size"); pageSize != "" {
+			n, err := strconv.ParseInt(pageSize, 10, 32)
+			if err != nil {
+				respond(c, http.StatusBadRequest, gin.H{"error": "page_size must be a number"})
+				return
+			}
+			req.PageSize = int32(n)
+		}
+
+		reply, err := users.ListUsers(c.Request.Context(), req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, http.StatusOK, reply)
 	}
 }
 
-func GetById() gin.HandlerFunc {
+func GetById(users userpb.UserServiceServer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		slog.Info("getting a user", slog.String("id", id))
+		userID := c.Param("id")
+		slog.Info("getting a user", slog.String("id", userID))
 
-		intId, err := strconv.ParseInt(id, 10, 64)
+		user, err := users.GetUser(c.Request.Context(), &userpb.GetUserRequest{Id: userID})
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-
-		slog.Info("getting user by id")
-
-		c.JSON(http.StatusOK, users[intId])
+		respond(c, http.StatusOK, user)
 	}
 }
 
-func New() gin.HandlerFunc {
+// New creates a user and replies with it. The service publishes the
+// UserCreated event.
+func New(users userpb.UserServiceServer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		slog.Info("creating a user")
-		users = append(users, "John Doe")
-		c.JSON(http.StatusOK, "user created")
+
+		var req userpb.CreateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.GetName() == "" || req.GetEmail() == "" {
+			respond(c, http.StatusBadRequest, gin.H{"error": "name and email are required"})
+			return
+		}
+
+		created, err := users.CreateUser(c.Request.Context(), &req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		user, err := users.GetUser(c.Request.Context(), &userpb.GetUserRequest{Id: created.GetId()})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, http.StatusCreated, user)
 	}
 }
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-learning/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewUserValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/users", New(services.NewUserServer(services.NewStores(), 0)))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"created", "application/json", `{"name":"Joe","email":"joe@example.com"}`, http.StatusCreated},
+		{"missing email", "application/json", `{"name":"Joe"}`, http.StatusBadRequest},
+		{"empty body", "application/json", `{}`, http.StatusBadRequest},
+		{"not JSON", "", `name=Joe&email=joe@example.com`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, but got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			if tt.want == http.StatusCreated {
+				var user map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil || user["name"] != "Joe" {
+					t.Errorf("Expected the created user, but got %s", rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestGetListFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/users", GetList(services.NewUserServer(services.NewStores(), 0)))
+
+	for _, accept := range []string{"application/json", "application/yaml", "application/x-protobuf"} {
+		t.Run(accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Accept", accept)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected status %d, but got %d: %s", http.StatusOK, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Package idempotency makes create requests safe to retry. The reply of a
+// request carrying a client chosen key is remembered for a while, and a
+// retry with the same key gets that reply back instead of creating the
+// resource again.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrConflict is returned when a key is reused with a different request.
+var ErrConflict = errors.New("request id already used with a different request")
+
+// Store remembers the replies of the requests made in the last window. It
+// is safe for concurrent use.
+type Store[R proto.Message] struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry[R]
+	// order lists the entries oldest first, all of them live for the same
+	// window so the expired ones are always at the front
+	order []queued[R]
+}
+
+type queued[R proto.Message] struct {
+	key   string
+	entry *entry[R]
+}
+
+type entry[R proto.Message] struct {
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+	done        chan struct{} // closed once reply and err are set
+	reply       R
+	err         error
+}
+
+// New returns a store remembering replies for window, 0 disables
+// deduplication. now is time.Now when nil.
+func New[R proto.Message](window time.Duration, now func() time.Time) *Store[R] {
+	if now == nil {
+		now = time.Now
+	}
+	return &Store[R]{window: window, now: now, entries: make(map[string]*entry[R])}
+}
+
+// Do runs create for the first request with the given key and returns its
+// reply. A later request with the same key and an identical req gets a
+// copy of that reply, one with a different req gets ErrConflict. Requests
+// arriving while the first one runs wait for it. Failures are not
+// remembered, the request can be retried with the same key.
+//
+// An empty key, or a store with no window, always runs create. The key of
+// req must be cleared or be part of the key itself: it is hashed to tell
+// retries from conflicts.
+func (s *Store[R]) Do(key string, req proto.Message, create func() (R, error)) (R, error) {
+	if key == "" || s.window <= 0 {
+		return create()
+	}
+
+	fingerprint, err := hash(req)
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+
+	s.mu.Lock()
+	s.expire()
+	if e, ok := s.entries[key]; ok {
+		s.mu.Unlock()
+		if e.fingerprint != fingerprint {
+			var zero R
+			return zero, ErrConflict
+		}
+		<-e.done
+		if e.err != nil {
+			// the first attempt failed and was forgotten, try again
+			return s.Do(key, req, create)
+		}
+		return proto.Clone(e.reply).(R), nil
+	}
+
+	e := &entry[R]{fingerprint: fingerprint, expires: s.now().Add(s.window), done: make(chan struct{})}
+	s.entries[key] = e
+	s.order = append(s.order, queued[R]{key, e})
+	s.mu.Unlock()
+
+	e.reply, e.err = create()
+	if e.err != nil {
+		s.mu.Lock()
+		if s.entries[key] == e {
+			delete(s.entries, key)
+		}
+		s.mu.Unlock()
+	}
+	close(e.done)
+	return e.reply, e.err
+}
+
+// Len returns how many replies are remembered.
+func (s *Store[R]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return len(s.entries)
+}
+
+// expire forgets the replies older than the window, s.mu must be held.
+func (s *Store[R]) expire() {
+	now := s.now()
+	n := 0
+	for _, q := range s.order {
+		if now.Before(q.entry.expires) {
+			break
+		}
+		// the key may have been reused after a failure
+		if s.entries[q.key] == q.entry {
+			delete(s.entries, q.key)
+		}
+		n++
+	}
+	if n > 0 {
+		// shift instead of reslicing, so the backing array doesn't grow forever
+		s.order = s.order[:copy(s.order, s.order[n:])]
+	}
+}
+
+// hash fingerprints a request, deterministic marshaling makes equal
+// messages hash the same.
+func hash(req proto.Message) ([sha256.Size]byte, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
@@ -0,0 +1,104 @@
+package idempotency
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// counter returns a create function numbering its replies.
+func counter() (func() (*wrapperspb.Int64Value, error), *atomic.Int64) {
+	var n atomic.Int64
+	return func() (*wrapperspb.Int64Value, error) {
+		return wrapperspb.Int64(n.Add(1)), nil
+	}, &n
+}
+
+func TestDo(t *testing.T) {
+	s := New[*wrapperspb.Int64Value](time.Minute, nil)
+	create, calls := counter()
+
+	first, _ := s.Do("k1", wrapperspb.String("a"), create)
+	retry, _ := s.Do("k1", wrapperspb.String("a"), create)
+	if calls.Load() != 1 || retry.GetValue() != first.GetValue() {
+		t.Errorf("Expected the retry to get reply %d without creating, but got %d after %d calls", first.GetValue(), retry.GetValue(), calls.Load())
+	}
+
+	if _, err := s.Do("k1", wrapperspb.String("b"), create); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict for a different request, but got %v", err)
+	}
+
+	other, _ := s.Do("k2", wrapperspb.String("a"), create)
+	noKey, _ := s.Do("", wrapperspb.String("a"), create)
+	if other.GetValue() != 2 || noKey.GetValue() != 3 {
+		t.Errorf("Expected other keys and no key to create, but got %d and %d", other.GetValue(), noKey.GetValue())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	s := New[*wrapperspb.Int64Value](time.Minute, func() time.Time { return now })
+	create, calls := counter()
+
+	s.Do("k1", wrapperspb.String("a"), create)
+	now = now.Add(30 * time.Second)
+	s.Do("k2", wrapperspb.String("a"), create)
+
+	now = now.Add(31 * time.Second)
+	if s.Len() != 1 {
+		t.Errorf("Expected only k2 to be remembered, but got %d replies", s.Len())
+	}
+	// once forgotten, the key creates again, whatever the request
+	if reply, _ := s.Do("k1", wrapperspb.String("b"), create); reply.GetValue() != 3 || calls.Load() != 3 {
+		t.Errorf("Expected a new creation, but got %d", reply.GetValue())
+	}
+}
+
+func TestFailureNotRemembered(t *testing.T) {
+	s := New[*wrapperspb.Int64Value](time.Minute, nil)
+	failure := errors.New("out of stock")
+
+	if _, err := s.Do("k1", wrapperspb.String("a"), func() (*wrapperspb.Int64Value, error) { return nil, failure }); !errors.Is(err, failure) {
+		t.Fatalf("Expected the failure, but got %v", err)
+	}
+	create, _ := counter()
+	if reply, err := s.Do("k1", wrapperspb.String("a"), create); err != nil || reply.GetValue() != 1 {
+		t.Errorf("Expected the retry to create, but got %v, %v", reply, err)
+	}
+}
+
+func TestConcurrentRetries(t *testing.T) {
+	s := New[*wrapperspb.Int64Value](time.Minute, nil)
+	release := make(chan struct{})
+	var calls atomic.Int64
+	create := func() (*wrapperspb.Int64Value, error) {
+		<-release
+		return wrapperspb.Int64(calls.Add(1)), nil
+	}
+
+	var wg sync.WaitGroup
+	replies := make([]int64, 10)
+	for i := range replies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := s.Do("k1", wrapperspb.String("a"), create)
+			if err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			replies[i] = reply.GetValue()
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	for _, reply := range replies {
+		if reply != 1 {
+			t.Fatalf("Expected every request to get the first reply, but got %v", replies)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go-learning/pkg/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Auth validates the JWT bearer token sent in the "authorization" metadata.
+// Every method is private unless it matches one of the Public patterns.
+type Auth struct {
+	Secret []byte
+	// Public lists the methods callable without a token, either a full
+	// method ("/user.UserService/GetUser") or a whole service
+	// ("/grpc.health.v1.Health/*").
+	Public []string
+}
+
+// IsPublic reports whether fullMethod can be called without a token.
+func (a Auth) IsPublic(fullMethod string) bool {
+	for _, pattern := range a.Public {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(fullMethod, prefix) {
+				return true
+			}
+		} else if pattern == fullMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// Unary returns the interceptor authenticating unary RPCs. The claims of
+// the caller are available to handlers through auth.FromContext.
+func (a Auth) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor authenticating streaming RPCs.
+func (a Auth) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (a Auth) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.IsPublic(fullMethod) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+
+	claims, err := auth.Verify(a.Secret, token, time.Now())
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired), errors.Is(err, auth.ErrTokenNotYetValid):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		// don't tell which part of the token was wrong
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return auth.NewContext(ctx, claims), nil
+}
@@ -0,0 +1,66 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-learning/pkg/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthUnary(t *testing.T) {
+	secret := []byte("test-secret")
+	interceptor := Auth{
+		Secret: secret,
+		Public: []string{"/user.UserService/GetUser", "/grpc.health.v1.Health/*"},
+	}.Unary()
+
+	valid, _ := auth.GenerateJWT(secret, "u1", time.Minute)
+	expired, _ := auth.Sign(secret, auth.Claims{Subject: "u1", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	forged, _ := auth.GenerateJWT([]byte("other"), "u1", time.Minute)
+
+	tests := []struct {
+		name    string
+		method  string
+		header  string
+		want    codes.Code
+		subject string
+	}{
+		{"public method", "/user.UserService/GetUser", "", codes.OK, ""},
+		{"public service", "/grpc.health.v1.Health/Check", "", codes.OK, ""},
+		{"valid token", "/user.UserService/CreateUser", "Bearer " + valid, codes.OK, "u1"},
+		{"missing token", "/user.UserService/CreateUser", "", codes.Unauthenticated, ""},
+		{"not a bearer token", "/user.UserService/CreateUser", "Basic dTE6cHc=", codes.Unauthenticated, ""},
+		{"expired token", "/user.UserService/CreateUser", "Bearer " + expired, codes.Unauthenticated, ""},
+		{"forged token", "/user.UserService/CreateUser", "Bearer " + forged, codes.Unauthenticated, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.header != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.header))
+			}
+
+			var subject string
+			handler := func(ctx context.Context, req any) (any, error) {
+				claims, _ := auth.FromContext(ctx)
+				subject = claims.Subject
+				return "ok", nil
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.want {
+				t.Errorf("Expected code %v, but got %v", tt.want, err)
+			}
+			if subject != tt.subject {
+				t.Errorf("Expected subject %q in the context, but got %q", tt.subject, subject)
+			}
+		})
+	}
+}
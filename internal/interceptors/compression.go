@@ -0,0 +1,35 @@
+package interceptors
+
+import (
+	"context"
+	"slices"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryCompression compresses replies with the named compressor when the
+// client advertises it in grpc-accept-encoding. The compressor must be
+// registered, e.g. by importing google.golang.org/grpc/encoding/gzip.
+func UnaryCompression(name string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		setSendCompressor(ctx, name)
+		return handler(ctx, req)
+	}
+}
+
+// StreamCompression is UnaryCompression for streaming RPCs.
+func StreamCompression(name string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		setSendCompressor(ss.Context(), name)
+		return handler(srv, ss)
+	}
+}
+
+func setSendCompressor(ctx context.Context, name string) {
+	accepted, err := grpc.ClientSupportedCompressors(ctx)
+	if err == nil && slices.Contains(accepted, name) {
+		// only fails when the compressor isn't registered, replies are
+		// then sent uncompressed
+		_ = grpc.SetSendCompressor(ctx, name)
+	}
+}
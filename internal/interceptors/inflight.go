@@ -0,0 +1,37 @@
+package interceptors
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// InFlight counts the RPCs being handled, so a shutdown can tell how many
+// it is waiting for.
+type InFlight struct {
+	n atomic.Int64
+}
+
+// Count returns the number of RPCs being handled.
+func (f *InFlight) Count() int64 {
+	return f.n.Load()
+}
+
+// Unary returns the interceptor counting unary RPCs.
+func (f *InFlight) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		f.n.Add(1)
+		defer f.n.Add(-1)
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor counting open streams.
+func (f *InFlight) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		f.n.Add(1)
+		defer f.n.Add(-1)
+		return handler(srv, ss)
+	}
+}
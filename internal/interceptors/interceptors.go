@@ -0,0 +1,38 @@
+// Package interceptors holds the gRPC server interceptors, the counterpart
+// of the gin middlewares in internal/middleware.
+package interceptors
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// splitMethod splits "/pkg.Service/Method" into "pkg.Service" and "Method".
+func splitMethod(fullMethod string) (service, method string) {
+	service, method, _ = strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service, method
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	default:
+		return "server_stream"
+	}
+}
+
+// serverStream overrides the context of a stream, interceptors can only
+// pass values down to the handler this way.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
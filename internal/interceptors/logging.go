@@ -0,0 +1,75 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key of the request id, the same header the
+// REST API uses.
+const RequestIDKey = "x-request-id"
+
+// UnaryLogging writes one structured log line per RPC.
+func UnaryLogging() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRPC(ctx, info.FullMethod, "unary", time.Since(start), err)
+		return resp, err
+	}
+}
+
+// StreamLogging writes one structured log line when a stream ends.
+func StreamLogging() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logRPC(ss.Context(), info.FullMethod, streamType(info), time.Since(start), err)
+		return err
+	}
+}
+
+func logRPC(ctx context.Context, fullMethod, rpcType string, latency time.Duration, err error) {
+	st := status.Convert(err)
+
+	level := slog.LevelInfo
+	switch st.Code() {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+
+	service, method := splitMethod(fullMethod)
+	attrs := []slog.Attr{
+		slog.String("service", service),
+		slog.String("method", method),
+		slog.String("type", rpcType),
+		slog.String("code", st.Code().String()),
+		slog.Duration("latency", latency),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDKey); len(ids) > 0 {
+			attrs = append(attrs, slog.String("request_id", ids[0]))
+		}
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			attrs = append(attrs, slog.String("user_agent", ua[0]))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", st.Message()))
+	}
+
+	slog.LogAttrs(ctx, level, "grpc request", attrs...)
+}
@@ -0,0 +1,67 @@
+package interceptors
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics records the number and latency of RPCs per method and code.
+type Metrics struct {
+	handled *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+}
+
+// NewMetrics creates the RPC metrics and registers them with reg.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	labels := []string{"grpc_service", "grpc_method", "grpc_type", "grpc_code"}
+	m := &Metrics{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of the RPCs handled by the server",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+	}
+	reg.MustRegister(m.handled, m.latency)
+	return m
+}
+
+// Unary returns the interceptor recording unary RPCs.
+func (m *Metrics) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, "unary", time.Since(start), err)
+		return resp, err
+	}
+}
+
+// Stream returns the interceptor recording streaming RPCs, the latency is
+// the lifetime of the stream.
+func (m *Metrics) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(info.FullMethod, streamType(info), time.Since(start), err)
+		return err
+	}
+}
+
+func (m *Metrics) observe(fullMethod, rpcType string, latency time.Duration, err error) {
+	service, method := splitMethod(fullMethod)
+	labels := prometheus.Labels{
+		"grpc_service": service,
+		"grpc_method":  method,
+		"grpc_type":    rpcType,
+		"grpc_code":    status.Code(err).String(),
+	}
+	m.handled.With(labels).Inc()
+	m.latency.With(labels).Observe(latency.Seconds())
+}
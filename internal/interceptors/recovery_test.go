@@ -0,0 +1,24 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryRecovery(t *testing.T) {
+	handler := func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	}
+
+	_, err := UnaryRecovery()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUser"}, handler)
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Expected code %v, but got %v", codes.Internal, err)
+	}
+	if status.Convert(err).Message() != "internal error" {
+		t.Errorf("Expected the panic to stay out of the message, but got %q", status.Convert(err).Message())
+	}
+}
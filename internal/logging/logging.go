@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Setup installs the default slog logger and returns the variable holding
+// its level, so the level can be changed while the process is running.
+// format is either "json" or "text".
+func Setup(level, format string) *slog.LevelVar {
+	levelVar := new(slog.LevelVar)
+	levelErr := levelVar.UnmarshalText([]byte(level))
+
+	opts := &slog.HandlerOptions{Level: levelVar}
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	if levelErr != nil {
+		slog.Warn("invalid log level, using info", slog.String("level", level))
+	}
+	return levelVar
+}
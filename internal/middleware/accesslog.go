@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-learning/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const redacted = "REDACTED"
+
+// AccessLog writes one structured log line per request. Errors and slow
+// requests are always logged, the rest is sampled with cfg.SampleRate.
+// Values of the parameters listed in cfg.RedactParams are hidden, both in
+// the path and in the query string.
+func AccessLog(cfg config.AccessLogConfig) gin.HandlerFunc {
+	redact := make(map[string]bool, len(cfg.RedactParams))
+	for _, name := range cfg.RedactParams {
+		redact[strings.ToLower(name)] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+
+		status := c.Writer.Status()
+		slow := cfg.SlowThreshold > 0 && latency >= cfg.SlowThreshold
+		if status < http.StatusBadRequest && !slow && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest || slow:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", redactPath(c, redact)),
+			slog.String("query", redactQuery(c.Request.URL.RawQuery, redact)),
+			slog.Int("status", status),
+			slog.Duration("latency", latency),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+			slog.String("request_id", c.GetString(RequestIDKey)),
+		}
+		if slow {
+			attrs = append(attrs, slog.Bool("slow", true))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "http request", attrs...)
+	}
+}
+
+// redactPath replaces the values of sensitive route parameters, e.g.
+// /reset/:token logs as /reset/REDACTED.
+func redactPath(c *gin.Context, redact map[string]bool) string {
+	path := c.Request.URL.Path
+	route := c.FullPath()
+	if route == "" {
+		return path
+	}
+
+	routeParts := strings.Split(route, "/")
+	pathParts := strings.Split(path, "/")
+	for i, part := range routeParts {
+		if i >= len(pathParts) {
+			break
+		}
+		switch {
+		case strings.HasPrefix(part, ":") && redact[strings.ToLower(part[1:])]:
+			pathParts[i] = redacted
+		case strings.HasPrefix(part, "*") && redact[strings.ToLower(part[1:])]:
+			// catch-all parameters swallow the rest of the path
+			return strings.Join(append(pathParts[:i], redacted), "/")
+		}
+	}
+	return strings.Join(pathParts, "/")
+}
+
+func redactQuery(rawQuery string, redact map[string]bool) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// don't risk logging a secret we couldn't parse
+		return redacted
+	}
+	for key := range values {
+		if redact[strings.ToLower(key)] {
+			values[key] = []string{redacted}
+		}
+	}
+	return values.Encode()
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-learning/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccessLogRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), AccessLog(config.AccessLogConfig{
+		SampleRate:   1,
+		RedactParams: []string{"token", "password"},
+	}))
+	router.GET("/reset/:token", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/reset/abc123?password=hunter2&page=2", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	for _, secret := range []string{"abc123", "hunter2"} {
+		if strings.Contains(line, secret) {
+			t.Errorf("Expected %q to be redacted, but got %s", secret, line)
+		}
+	}
+	for _, want := range []string{"route=/reset/:token", "path=/reset/REDACTED", "page=2", "request_id=req-1", "status=200"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected log line to contain %q, but got %s", want, line)
+		}
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AccessLog(config.AccessLogConfig{SampleRate: 0}))
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if buf.Len() != 0 {
+		t.Errorf("Expected successful request to be sampled out, but got %s", buf.String())
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if !strings.Contains(buf.String(), "level=ERROR") {
+		t.Errorf("Expected failed request to always be logged, but got %s", buf.String())
+	}
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-learning/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoders are expensive to create (zstd allocates large windows),
+// so they are pooled and reset for every response.
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	zstdWriters = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+)
+
+// Compress compresses response bodies with zstd or gzip, depending on the
+// Accept-Encoding header. Bodies are buffered until cfg.MinSize bytes are
+// written, smaller responses are sent as they are since compressing them
+// costs more than it saves.
+func Compress(cfg config.CompressionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		// the body depends on Accept-Encoding even when we end up not compressing
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: cfg.MinSize}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// Decompress transparently decodes gzip or zstd encoded request bodies so
+// handlers can bind them as usual. The decoded size is capped to protect
+// against compression bombs.
+func Decompress(cfg config.CompressionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body io.ReadCloser
+		switch strings.ToLower(c.GetHeader("Content-Encoding")) {
+		case "", "identity":
+			c.Next()
+			return
+		case "gzip":
+			gz, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid gzip body: " + err.Error()})
+				return
+			}
+			body = gz
+		case "zstd":
+			zr, err := zstd.NewReader(c.Request.Body, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid zstd body: " + err.Error()})
+				return
+			}
+			body = zr.IOReadCloser()
+		default:
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported content encoding"})
+			return
+		}
+		defer body.Close()
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, body, cfg.MaxRequestBodyBytes)
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Del("Content-Length")
+		c.Request.ContentLength = -1
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks zstd over gzip when the client accepts both.
+// Encodings with q=0 are explicitly refused by the client.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[strings.ToLower(name)] = q > 0
+	}
+
+	switch {
+	case accepted["zstd"]:
+		return "zstd"
+	case accepted["gzip"]:
+		return "gzip"
+	default:
+		return ""
+	}
+}
+
+// compressWriter holds back the body until it knows whether it's worth
+// compressing, then either starts an encoder or writes the buffer as is.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	encoder io.WriteCloser
+	skip    bool // decided to send the body uncompressed
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	switch {
+	case w.skip:
+		return w.ResponseWriter.Write(p)
+	case w.encoder != nil:
+		return w.encoder.Write(p)
+	}
+
+	// the handler already encoded the body or there is no body to compress
+	status := w.Status()
+	if w.Header().Get("Content-Encoding") != "" || status == http.StatusNoContent || status == http.StatusNotModified {
+		if err := w.sendRaw(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < w.minSize {
+		return len(p), nil
+	}
+	if err := w.startEncoder(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends whatever is buffered, streaming responses can't wait for
+// the size threshold.
+func (w *compressWriter) Flush() {
+	switch {
+	case w.encoder != nil:
+		if f, ok := w.encoder.(interface{ Flush() error }); ok {
+			_ = f.Flush()
+		}
+	case !w.skip:
+		_ = w.sendRaw()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) startEncoder() error {
+	h := w.Header()
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+
+	switch w.encoding {
+	case "zstd":
+		enc := zstdWriters.Get().(*zstd.Encoder)
+		enc.Reset(w.ResponseWriter)
+		w.encoder = enc
+	default:
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(w.ResponseWriter)
+		w.encoder = gz
+	}
+
+	_, err := w.encoder.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) sendRaw() error {
+	w.skip = true
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// close finishes the response once the handlers are done.
+func (w *compressWriter) close() {
+	if w.encoder == nil {
+		_ = w.sendRaw()
+		return
+	}
+
+	_ = w.encoder.Close()
+	switch enc := w.encoder.(type) {
+	case *zstd.Encoder:
+		enc.Reset(nil)
+		zstdWriters.Put(enc)
+	case *gzip.Writer:
+		enc.Reset(io.Discard)
+		gzipWriters.Put(enc)
+	}
+	w.encoder = nil
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-learning/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"zstd;q=0, gzip;q=0.5", "gzip"},
+		{"br", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressThreshold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Compress(config.CompressionConfig{MinSize: 100}))
+	router.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "tiny") })
+	router.GET("/large", func(c *gin.Context) { c.String(http.StatusOK, strings.Repeat("a", 1000)) })
+
+	req := httptest.NewRequest(http.MethodGet, "/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "tiny" {
+		t.Errorf("Expected small body to be sent uncompressed, but got %q (%q)", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/large", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Encoding"); got != "zstd" {
+		t.Fatalf("Expected zstd encoding, but got %q", got)
+	}
+	dec, err := zstd.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	body, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 1000 {
+		t.Errorf("Expected 1000 decompressed bytes, but got %v", len(body))
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Decompress(config.CompressionConfig{MaxRequestBodyBytes: 1 << 10}))
+	router.POST("/echo", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("hello"))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected decompressed body hello, but got %v %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello"))
+	req.Header.Set("Content-Encoding", "br")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, but got %v", w.Code)
+	}
+}
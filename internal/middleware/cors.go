@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-learning/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS answers preflight requests and adds the Access-Control-* headers to
+// responses for origins allowed by cfg. Requests from other origins are
+// passed through untouched, the browser will then block the response.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		// responses differ per origin, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if !originAllowed(cfg.AllowedOrigins, origin) {
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if slices.Contains(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// browsers reject "*" together with credentials, echo the origin back
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if exposeHeaders != "" {
+			h.Set("Access-Control-Expose-Headers", exposeHeaders)
+		}
+		c.Next()
+	}
+}
+
+// EnableCORS installs the CORS middleware on a route group. Gin only runs
+// group middleware for matched routes, so a catch-all OPTIONS route is
+// registered as well to let preflight requests reach the middleware.
+func EnableCORS(group *gin.RouterGroup, cfg config.CORSConfig) {
+	group.Use(CORS(cfg))
+	group.OPTIONS("/*path", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// originAllowed reports whether origin matches one of the allowed patterns.
+// A pattern may contain a single "*" matching any run of characters.
+func originAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if pattern == origin {
+				return true
+			}
+			continue
+		}
+		if len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
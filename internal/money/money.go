@@ -0,0 +1,110 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currencies don't match")
+	ErrInvalidCurrency  = errors.New("currency must be a 3 letter ISO 4217 code")
+)
+
+// exponents lists the currencies that don't use 2 decimal places.
+var exponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"CLP": 0,
+	"KWD": 3,
+	"BHD": 3,
+}
+
+// Money is an amount in the currency's minor unit (cents for USD), integer
+// arithmetic keeps prices exact where floats would drift.
+type Money struct {
+	Amount   int64  `json:"amount" yaml:"amount"`
+	Currency string `json:"currency" yaml:"currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code, e.g. "USD".
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// BasisPoints returns bps/10000 of the amount, rounded half away from zero,
+// e.g. a 16% tax is 1600 basis points.
+func (m Money) BasisPoints(bps int64) Money {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(bps))
+	quo, rem := new(big.Int).QuoRem(product, big.NewInt(10000), new(big.Int))
+	if rem.Abs(rem).Int64()*2 >= 10000 {
+		if product.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return Money{Amount: quo.Int64(), Currency: m.Currency}
+}
+
+// Major returns the amount in major units as a float, only meant for
+// display and for deprecated fields that still carry floats.
+func (m Money) Major() float64 {
+	f := float64(m.Amount)
+	for range exponent(m.Currency) {
+		f /= 10
+	}
+	return f
+}
+
+func (m Money) String() string {
+	exp := exponent(m.Currency)
+	if exp == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	div := int64(1)
+	for range exp {
+		div *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/div, exp, amount%div, m.Currency)
+}
+
+func exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
@@ -0,0 +1,55 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount int64
+		bps    int64
+		want   int64
+	}{
+		{1000, 1600, 160},
+		{1005, 1000, 101}, // 100.5 rounds up
+		{1004, 1000, 100},
+		{-1005, 1000, -101},
+		{0, 1600, 0},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.amount, "USD").BasisPoints(tt.bps).Amount; got != tt.want {
+			t.Errorf("BasisPoints(%v, %v) = %v, want %v", tt.amount, tt.bps, got, tt.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	sum, err := New(150, "USD").Add(New(275, "USD"))
+	if err != nil || sum.Amount != 425 {
+		t.Errorf("Expected 425 USD, but got %v (%v)", sum, err)
+	}
+
+	if _, err := New(150, "USD").Add(New(1, "MXN")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Expected ErrCurrencyMismatch, but got %v", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{New(4999, "USD"), "49.99 USD"},
+		{New(-5, "EUR"), "-0.05 EUR"},
+		{New(500, "JPY"), "500 JPY"},
+		{New(1500, "KWD"), "1.500 KWD"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
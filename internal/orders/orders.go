@@ -0,0 +1,279 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go-learning/internal/catalog"
+	"go-learning/internal/money"
+	"go-learning/internal/validation"
+	"go-learning/pkg/id"
+)
+
+const (
+	// MaxProducts is the maximum number of line items in a single order.
+	MaxProducts = 50
+	// MaxQuantity is the maximum quantity of a single line item.
+	MaxQuantity = 1000
+)
+
+var (
+	ErrMissingUser        = errors.New("user_id is required")
+	ErrNoProducts         = errors.New("an order needs at least one product")
+	ErrItemsAndProductIDs = errors.New("use either items or product_ids, not both")
+	ErrDuplicateProduct   = errors.New("product ids must be unique")
+	ErrTooManyProducts    = fmt.Errorf("an order can't have more than %d products", MaxProducts)
+	ErrMissingProductID   = errors.New("product id must not be empty")
+	ErrInvalidQuantity    = fmt.Errorf("quantity must be between 1 and %d", MaxQuantity)
+	ErrUnknownProduct     = errors.New("product does not exist")
+	ErrOutOfStock         = errors.New("not enough stock")
+	// ErrInvalidTransition is wrapped with the states involved.
+	ErrInvalidTransition = errors.New("invalid order state transition")
+)
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StatePaid      State = "paid"
+	StateShipped   State = "shipped"
+	StateDelivered State = "delivered"
+	StateCancelled State = "cancelled"
+	StateRefunded  State = "refunded"
+)
+
+// transitions lists the states every state can move to. Cancelling is only
+// possible before payment, afterwards the money has to be refunded.
+var transitions = map[State][]State{
+	StatePending:   {StatePaid, StateCancelled},
+	StatePaid:      {StateShipped, StateRefunded},
+	StateShipped:   {StateDelivered},
+	StateDelivered: {StateRefunded},
+	StateCancelled: nil,
+	StateRefunded:  nil,
+}
+
+// next is the happy path followed by Advance.
+var next = map[State]State{
+	StatePending: StatePaid,
+	StatePaid:    StateShipped,
+	StateShipped: StateDelivered,
+}
+
+// Transition records when an order entered a state.
+type Transition struct {
+	State State     `json:"state" yaml:"state"`
+	At    time.Time `json:"at" yaml:"at"`
+}
+
+// Item is a product and the quantity requested by the client.
+type Item struct {
+	ProductID string `json:"product_id" yaml:"product_id"`
+	Quantity  int64  `json:"quantity" yaml:"quantity"`
+}
+
+// Request is an order as asked for by a client. Older clients send bare
+// product ids, which count as one unit of each product.
+type Request struct {
+	UserID     string
+	ProductIDs []string
+	Items      []Item
+}
+
+// LineItem is an Item priced from the catalog at the time of the order.
+type LineItem struct {
+	ProductID string      `json:"product_id" yaml:"product_id"`
+	SKU       string      `json:"sku" yaml:"sku"`
+	Quantity  int64       `json:"quantity" yaml:"quantity"`
+	UnitPrice money.Money `json:"unit_price" yaml:"unit_price"`
+	Total     money.Money `json:"total" yaml:"total"`
+}
+
+// Pricing holds the rules applied on top of the catalog prices.
+type Pricing struct {
+	TaxBasisPoints int64 // e.g. 1600 for a 16% tax
+}
+
+// ProductLookup finds a product in the catalog.
+type ProductLookup func(id string) (catalog.Product, bool)
+
+// Order holds the business rules shared by the REST handlers and the gRPC
+// OrderService, each of them only maps it to its own wire format.
+type Order struct {
+	ID       string       `json:"id" yaml:"id"`
+	UserID   string       `json:"user_id" yaml:"user_id"`
+	Items    []LineItem   `json:"items" yaml:"items"`
+	Subtotal money.Money  `json:"subtotal" yaml:"subtotal"`
+	Discount money.Money  `json:"discount" yaml:"discount"`
+	Tax      money.Money  `json:"tax" yaml:"tax"`
+	Total    money.Money  `json:"total" yaml:"total"`
+	State    State        `json:"state" yaml:"state"`
+	History  []Transition `json:"history" yaml:"history"`
+}
+
+// LineItems returns the requested items, turning product ids into items.
+func (r Request) LineItems() []Item {
+	if len(r.Items) > 0 {
+		return r.Items
+	}
+
+	items := make([]Item, len(r.ProductIDs))
+	for i, id := range r.ProductIDs {
+		items[i] = Item{ProductID: id, Quantity: 1}
+	}
+	return items
+}
+
+// itemField names the request field of the i-th item in validation errors.
+func (r Request) itemField(i int) string {
+	if len(r.Items) > 0 {
+		return fmt.Sprintf("items[%d]", i)
+	}
+	return fmt.Sprintf("product_ids[%d]", i)
+}
+
+// Validate checks a new order and reports every invalid field at once.
+// It doesn't need the catalog, New checks the products themselves.
+func (r Request) Validate() error {
+	var errs []error
+	if r.UserID == "" {
+		errs = append(errs, validation.Field("user_id", ErrMissingUser))
+	} else if err := id.Validate(id.User, r.UserID); err != nil {
+		errs = append(errs, validation.Field("user_id", err))
+	}
+
+	items := r.LineItems()
+	switch {
+	case len(r.Items) > 0 && len(r.ProductIDs) > 0:
+		errs = append(errs, validation.Field("items", ErrItemsAndProductIDs))
+	case len(items) == 0:
+		errs = append(errs, validation.Field("items", ErrNoProducts))
+	case len(items) > MaxProducts:
+		errs = append(errs, validation.Field("items", ErrTooManyProducts))
+	}
+
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		field := r.itemField(i)
+		if len(r.Items) > 0 {
+			field += ".product_id"
+		}
+		switch {
+		case item.ProductID == "":
+			errs = append(errs, validation.Field(field, ErrMissingProductID))
+		case seen[item.ProductID]:
+			errs = append(errs, validation.Field(field, ErrDuplicateProduct))
+		}
+		seen[item.ProductID] = true
+
+		if item.Quantity < 1 || item.Quantity > MaxQuantity {
+			errs = append(errs, validation.Field(r.itemField(i)+".quantity", ErrInvalidQuantity))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// New validates and prices a new pending order from the catalog. Checking
+// that the user exists and reserving the stock is up to the caller, since
+// each API has its own stores.
+func New(id string, req Request, lookup ProductLookup, pricing Pricing, now time.Time) (*Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	order := &Order{
+		ID:      id,
+		UserID:  req.UserID,
+		State:   StatePending,
+		History: []Transition{{State: StatePending, At: now}},
+	}
+
+	var errs []error
+	for i, item := range req.LineItems() {
+		product, ok := lookup(item.ProductID)
+		if !ok {
+			errs = append(errs, validation.Field(req.itemField(i), fmt.Errorf("%w: %q", ErrUnknownProduct, item.ProductID)))
+			continue
+		}
+		if product.Stock < item.Quantity {
+			errs = append(errs, validation.Field(req.itemField(i), fmt.Errorf("%w: %d of %q left", ErrOutOfStock, product.Stock, item.ProductID)))
+			continue
+		}
+
+		line := LineItem{
+			ProductID: product.ID,
+			SKU:       product.SKU,
+			Quantity:  item.Quantity,
+			UnitPrice: product.Price,
+			Total:     product.Price.Mul(item.Quantity),
+		}
+		if len(order.Items) > 0 && line.UnitPrice.Currency != order.Items[0].UnitPrice.Currency {
+			errs = append(errs, validation.Field(req.itemField(i), money.ErrCurrencyMismatch))
+			continue
+		}
+		order.Items = append(order.Items, line)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	order.price(pricing)
+	return order, nil
+}
+
+// price computes the totals, all line items share the same currency.
+func (o *Order) price(pricing Pricing) {
+	currency := o.Items[0].UnitPrice.Currency
+	o.Subtotal = money.New(0, currency)
+	for _, line := range o.Items {
+		o.Subtotal.Amount += line.Total.Amount
+	}
+
+	// there are no discount rules yet, the field is there for the API
+	o.Discount = money.New(0, currency)
+	taxable := money.New(o.Subtotal.Amount-o.Discount.Amount, currency)
+	o.Tax = taxable.BasisPoints(pricing.TaxBasisPoints)
+	o.Total = money.New(taxable.Amount+o.Tax.Amount, currency)
+}
+
+// ProductIDs lists the products of the order, one entry per line item.
+func (o *Order) ProductIDs() []string {
+	ids := make([]string, len(o.Items))
+	for i, line := range o.Items {
+		ids[i] = line.ProductID
+	}
+	return ids
+}
+
+// CanTransition reports whether an order in state from may move to state to.
+func CanTransition(from, to State) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// Transition moves the order to the given state, if the lifecycle allows it.
+func (o *Order) Transition(to State, now time.Time) error {
+	if !CanTransition(o.State, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, o.State, to)
+	}
+
+	o.State = to
+	o.History = append(o.History, Transition{State: to, At: now})
+	return nil
+}
+
+// Advance moves the order one step along pending, paid, shipped, delivered.
+func (o *Order) Advance(now time.Time) error {
+	to, ok := next[o.State]
+	if !ok {
+		return fmt.Errorf("%w: nothing comes after %s", ErrInvalidTransition, o.State)
+	}
+	return o.Transition(to, now)
+}
+
+// Cancel cancels an order that hasn't been paid yet.
+func (o *Order) Cancel(now time.Time) error {
+	return o.Transition(StateCancelled, now)
+}
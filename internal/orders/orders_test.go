@@ -0,0 +1,173 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go-learning/internal/catalog"
+	"go-learning/internal/money"
+	"go-learning/internal/validation"
+	"go-learning/pkg/id"
+)
+
+var testUser = id.New(id.User)
+
+var testCatalog = map[string]catalog.Product{
+	"p1": {ID: "p1", SKU: "KB-001", Price: money.New(4999, "USD"), Stock: 10},
+	"p2": {ID: "p2", SKU: "MS-001", Price: money.New(1999, "USD"), Stock: 1},
+	"p3": {ID: "p3", SKU: "MN-001", Price: money.New(300000, "MXN"), Stock: 5},
+}
+
+func lookup(id string) (catalog.Product, bool) {
+	product, ok := testCatalog[id]
+	return product, ok
+}
+
+func newTestOrder(t *testing.T, items ...Item) *Order {
+	t.Helper()
+	order, err := New("o1", Request{UserID: testUser, Items: items}, lookup, Pricing{}, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return order
+}
+
+func TestNew(t *testing.T) {
+	now := time.Now()
+	req := Request{UserID: testUser, Items: []Item{{ProductID: "p1", Quantity: 3}, {ProductID: "p2", Quantity: 1}}}
+	order, err := New("o1", req, lookup, Pricing{TaxBasisPoints: 1600}, now)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// 3 * 49.99 + 19.99 = 169.96, 16% tax = 27.19
+	if order.Subtotal != money.New(16996, "USD") {
+		t.Errorf("Expected subtotal of 169.96 USD, but got %v", order.Subtotal)
+	}
+	if order.Tax != money.New(2719, "USD") {
+		t.Errorf("Expected tax of 27.19 USD, but got %v", order.Tax)
+	}
+	if order.Total != money.New(19715, "USD") {
+		t.Errorf("Expected total of 197.15 USD, but got %v", order.Total)
+	}
+	if order.Items[0].SKU != "KB-001" || order.Items[0].Total != money.New(14997, "USD") {
+		t.Errorf("Expected priced line item for KB-001, but got %+v", order.Items[0])
+	}
+	if order.State != StatePending {
+		t.Errorf("Expected state %v, but got %v", StatePending, order.State)
+	}
+	if len(order.History) != 1 || !order.History[0].At.Equal(now) {
+		t.Errorf("Expected creation to be recorded in the history, but got %v", order.History)
+	}
+}
+
+func TestNewProductIDs(t *testing.T) {
+	order, err := New("o1", Request{UserID: testUser, ProductIDs: []string{"p1", "p2"}}, lookup, Pricing{}, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if order.Total != money.New(6998, "USD") {
+		t.Errorf("Expected one unit of each product, but got a total of %v", order.Total)
+	}
+	if !slices.Equal(order.ProductIDs(), []string{"p1", "p2"}) {
+		t.Errorf("Expected product ids [p1 p2], but got %v", order.ProductIDs())
+	}
+}
+
+func TestNewCatalogErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []Item
+		want  error
+	}{
+		{"unknown product", []Item{{ProductID: "nope", Quantity: 1}}, ErrUnknownProduct},
+		{"out of stock", []Item{{ProductID: "p2", Quantity: 2}}, ErrOutOfStock},
+		{"mixed currencies", []Item{{ProductID: "p1", Quantity: 1}, {ProductID: "p3", Quantity: 1}}, money.ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New("o1", Request{UserID: testUser, Items: tt.items}, lookup, Pricing{}, time.Now())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, but got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tooMany := make([]string, MaxProducts+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("p%d", i)
+	}
+
+	tests := []struct {
+		name       string
+		req        Request
+		wantFields []string
+	}{
+		{"valid", Request{UserID: testUser, ProductIDs: []string{"p1", "p2"}}, nil},
+		{"missing everything", Request{}, []string{"user_id", "items"}},
+		{"malformed user id", Request{UserID: "u1", ProductIDs: []string{"p1"}}, []string{"user_id"}},
+		{"order id as user id", Request{UserID: id.New(id.Order), ProductIDs: []string{"p1"}}, []string{"user_id"}},
+		{"duplicate product", Request{UserID: testUser, ProductIDs: []string{"p1", "p2", "p1"}}, []string{"product_ids[2]"}},
+		{"empty product id", Request{UserID: testUser, ProductIDs: []string{""}}, []string{"product_ids[0]"}},
+		{"too many products", Request{UserID: testUser, ProductIDs: tooMany}, []string{"items"}},
+		{"invalid quantity", Request{UserID: testUser, Items: []Item{{ProductID: "p1"}}}, []string{"items[0].quantity"}},
+		{"both items and product ids", Request{UserID: testUser, ProductIDs: []string{"p1"}, Items: []Item{{ProductID: "p2", Quantity: 1}}}, []string{"items"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, fieldErr := range validation.FieldErrors(tt.req.Validate()) {
+				fields = append(fields, fieldErr.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("Expected violations on %v, but got %v", tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	order := newTestOrder(t, Item{ProductID: "p1", Quantity: 1})
+
+	for _, want := range []State{StatePaid, StateShipped, StateDelivered} {
+		if err := order.Advance(time.Now()); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if order.State != want {
+			t.Errorf("Expected state %v, but got %v", want, order.State)
+		}
+	}
+	if err := order.Advance(time.Now()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition after delivery, but got %v", err)
+	}
+	if err := order.Transition(StateRefunded, time.Now()); err != nil {
+		t.Errorf("Expected delivered order to be refundable, but got %v", err)
+	}
+	if len(order.History) != 5 {
+		t.Errorf("Expected 5 transitions in the history, but got %v", len(order.History))
+	}
+}
+
+func TestCancel(t *testing.T) {
+	order := newTestOrder(t, Item{ProductID: "p1", Quantity: 1})
+
+	if err := order.Cancel(time.Now()); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if err := order.Cancel(time.Now()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, but got %v", err)
+	}
+
+	paid := newTestOrder(t, Item{ProductID: "p1", Quantity: 1})
+	paid.Advance(time.Now())
+	if err := paid.Cancel(time.Now()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected paid order to not be cancellable, but got %v", err)
+	}
+}
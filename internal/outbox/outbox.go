@@ -0,0 +1,141 @@
+// Package outbox publishes the events recorded by the stores. A write
+// stores its event as an outbox record in the same journal change as the
+// data, so the event exists if and only if the write does, and a relay
+// then hands the pending records to sinks until they all took them.
+//
+//	relay := outbox.NewRelay(stores.Outbox, []outbox.Sink{outbox.NewBusSink(bus)}, outbox.Options{})
+//	go relay.Run(ctx)
+//
+// Records are delivered at least once and, for a given aggregate, in the
+// order they were written.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go-learning/pkg/events"
+)
+
+// Record is an event waiting in the outbox.
+type Record struct {
+	// Seq orders the records of a store, it's assigned when the record is
+	// written.
+	Seq uint64 `json:"seq"`
+	// ID is the id of the event, it's kept by every delivery so consumers
+	// can drop duplicates.
+	ID string `json:"id"`
+	// Aggregate is the id of the entity the event is about, e.g. an order.
+	Aggregate string          `json:"aggregate"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewRecord returns the record of e, to be written with the change of
+// aggregate.
+func NewRecord(eventID, aggregate string, e events.Event, at time.Time) (Record, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return Record{}, fmt.Errorf("encoding a %s event: %w", e.EventType(), err)
+	}
+	return Record{ID: eventID, Aggregate: aggregate, Type: e.EventType(), Payload: payload, CreatedAt: at}, nil
+}
+
+// Source is where the relay reads the pending records, the outbox store.
+type Source interface {
+	// Pending returns up to limit undelivered records, by Seq.
+	Pending(limit int) []Record
+	// Stats returns the number of undelivered records and when the oldest
+	// one was written.
+	Stats() (pending int, oldest time.Time)
+	// MarkDelivered deletes the records with the given sequences.
+	MarkDelivered(seqs []uint64) error
+	// Added receives a value when records are written, so the relay
+	// doesn't wait for its next poll.
+	Added() <-chan struct{}
+}
+
+// Sink is where records are published to.
+type Sink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+	// Send publishes a record. It's retried while it fails, so a record can
+	// be sent more than once.
+	Send(ctx context.Context, r Record) error
+}
+
+// BusSink publishes the records to the subscribers of an event bus.
+type BusSink struct {
+	bus *events.Bus
+}
+
+// NewBusSink returns a sink publishing to bus.
+func NewBusSink(bus *events.Bus) *BusSink {
+	return &BusSink{bus: bus}
+}
+
+func (s *BusSink) Name() string { return "bus" }
+
+func (s *BusSink) Send(ctx context.Context, r Record) error {
+	e, err := events.Unmarshal(r.Type, r.Payload)
+	if err != nil {
+		return err
+	}
+	return s.bus.PublishWithID(ctx, r.ID, e)
+}
+
+// FileSink appends the records to a file as newline-delimited JSON, one
+// record per line, e.g. for another process to tail.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64 // of the complete lines
+}
+
+// OpenFileSink opens the file at path for appending, creating it if
+// needed.
+func OpenFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileSink{file: f, size: info.Size()}, nil
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+// Send writes the record and syncs the file, a record is only delivered
+// once it's on disk.
+func (s *FileSink) Send(ctx context.Context, r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		// a partial line would break the readers, the retry writes it whole
+		s.file.Truncate(s.size)
+		return err
+	}
+	s.size += int64(len(b)) + 1
+	// unsynced, the record is sent again and may be written twice
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
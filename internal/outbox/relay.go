@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go-learning/internal/config"
+	"go-learning/pkg/events"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options configures a relay, the zero value gives the defaults.
+type Options struct {
+	// Interval is how often the outbox is polled besides the notifications
+	// of new records, and how long a failed record waits. 1s by default.
+	Interval time.Duration
+	// Batch is how many records are read at a time, 100 by default.
+	Batch int
+	// Registerer gets the lag metrics of the relay, nil skips them.
+	Registerer prometheus.Registerer
+	// Now is time.Now by default.
+	Now func() time.Time
+}
+
+// Relay publishes the pending records of a source to its sinks, and marks
+// them delivered once every sink took them.
+type Relay struct {
+	source   Source
+	sinks    []Sink
+	interval time.Duration
+	batch    int
+	now      func() time.Time
+
+	// sent remembers the sinks that already took a record, so a failure
+	// of another sink doesn't send it to them again
+	sent map[uint64]map[string]bool
+
+	delivered *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+	lag       *prometheus.HistogramVec
+}
+
+// NewRelay returns a relay from source to sinks, Run starts it.
+func NewRelay(source Source, sinks []Sink, opts Options) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = 100
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	r := &Relay{
+		source:   source,
+		sinks:    sinks,
+		interval: opts.Interval,
+		batch:    opts.Batch,
+		now:      opts.Now,
+		sent:     make(map[uint64]map[string]bool),
+		delivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "outbox_delivered_total",
+			Help: "Total number of outbox records sent, by sink",
+		}, []string{"sink"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "outbox_delivery_failures_total",
+			Help: "Total number of failed sends of outbox records, by sink",
+		}, []string{"sink"}),
+		lag: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "outbox_delivery_lag_seconds",
+			Help:    "Time between the write of an outbox record and its send, by sink",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"sink"}),
+	}
+
+	if opts.Registerer != nil {
+		pending := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "outbox_pending_records",
+			Help: "Number of outbox records not delivered yet",
+		}, func() float64 {
+			n, _ := source.Stats()
+			return float64(n)
+		})
+		oldest := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "outbox_lag_seconds",
+			Help: "Age of the oldest outbox record not delivered yet, 0 when there is none",
+		}, func() float64 {
+			n, at := source.Stats()
+			if n == 0 {
+				return 0
+			}
+			return r.now().Sub(at).Seconds()
+		})
+		opts.Registerer.MustRegister(r.delivered, r.failures, r.lag, pending, oldest)
+	}
+	return r
+}
+
+// Start relays the records of source to the bus, and to cfg.File when set,
+// until the returned stop is called. stop delivers what's left and closes
+// the file, it must be called before the source is closed.
+func Start(cfg config.OutboxConfig, source Source, bus *events.Bus, reg prometheus.Registerer) (stop func(context.Context) error, err error) {
+	sinks := []Sink{NewBusSink(bus)}
+	var file *FileSink
+	if cfg.File != "" {
+		if file, err = OpenFileSink(cfg.File); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, file)
+	}
+	relay := NewRelay(source, sinks, Options{Interval: cfg.Interval, Registerer: reg})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	return func(ctx context.Context) error {
+		cancel()
+		<-done
+		err := relay.Flush(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Run relays the records until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.source.Added():
+		case <-timer.C:
+		}
+
+		// a full batch means there are more right away
+		for {
+			n, err := r.pass(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("outbox records not delivered, retrying", slog.String("error", err.Error()))
+			}
+			if err != nil || n < r.batch {
+				break
+			}
+		}
+		timer.Reset(r.interval)
+	}
+}
+
+// Flush relays the pending records until there are none left, e.g. on
+// shutdown once Run returned, they must not run at the same time. It
+// returns the failures, or ctx's error.
+func (r *Relay) Flush(ctx context.Context) error {
+	for {
+		n, err := r.pass(ctx)
+		if err != nil {
+			return err
+		}
+		if pending, _ := r.source.Stats(); pending == 0 || n == 0 {
+			return ctx.Err()
+		}
+	}
+}
+
+// pass sends a batch of pending records and marks the delivered ones. When
+// a record fails, the later records of its aggregate wait for the next
+// pass, so they're never delivered before it. It returns how many records
+// were read.
+func (r *Relay) pass(ctx context.Context) (int, error) {
+	records := r.source.Pending(r.batch)
+	failed := make(map[string]bool)
+	var delivered []uint64
+	var errs []error
+	for _, record := range records {
+		if failed[record.Aggregate] {
+			continue
+		}
+		if err := r.send(ctx, record); err != nil {
+			failed[record.Aggregate] = true
+			errs = append(errs, err)
+			continue
+		}
+		delivered = append(delivered, record.Seq)
+	}
+
+	if len(delivered) > 0 {
+		if err := r.source.MarkDelivered(delivered); err != nil {
+			// they're sent again by the next pass
+			return len(records), err
+		}
+		for _, seq := range delivered {
+			delete(r.sent, seq)
+		}
+	}
+	return len(records), errors.Join(errs...)
+}
+
+// send hands a record to the sinks that didn't take it yet.
+func (r *Relay) send(ctx context.Context, record Record) error {
+	sent := r.sent[record.Seq]
+	for _, sink := range r.sinks {
+		if sent[sink.Name()] {
+			continue
+		}
+		if err := sink.Send(ctx, record); err != nil {
+			r.failures.WithLabelValues(sink.Name()).Inc()
+			return err
+		}
+		r.delivered.WithLabelValues(sink.Name()).Inc()
+		r.lag.WithLabelValues(sink.Name()).Observe(r.now().Sub(record.CreatedAt).Seconds())
+		if sent == nil {
+			sent = make(map[string]bool)
+			r.sent[record.Seq] = sent
+		}
+		sent[sink.Name()] = true
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning/pkg/events"
+)
+
+// memory is a Source over a slice.
+type memory struct {
+	mu      sync.Mutex
+	pending []Record
+	added   chan struct{}
+}
+
+func newMemory(records ...Record) *memory {
+	for i := range records {
+		records[i].Seq = uint64(i + 1)
+	}
+	return &memory{pending: records, added: make(chan struct{}, 1)}
+}
+
+func (m *memory) Pending(limit int) []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.pending[:min(limit, len(m.pending))])
+}
+
+func (m *memory) Stats() (int, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pending) == 0 {
+		return 0, time.Time{}
+	}
+	return len(m.pending), m.pending[0].CreatedAt
+}
+
+func (m *memory) MarkDelivered(seqs []uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = slices.DeleteFunc(m.pending, func(r Record) bool { return slices.Contains(seqs, r.Seq) })
+	return nil
+}
+
+func (m *memory) Added() <-chan struct{} { return m.added }
+
+// recorder is a Sink keeping what it got, failing the records in fail.
+type recorder struct {
+	name string
+	mu   sync.Mutex
+	got  []uint64
+	fail map[uint64]bool
+}
+
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) Send(ctx context.Context, record Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[record.Seq] {
+		return errors.New("sink down")
+	}
+	r.got = append(r.got, record.Seq)
+	return nil
+}
+
+func record(t *testing.T, aggregate string, e events.Event) Record {
+	t.Helper()
+	r, err := NewRecord("evt_"+aggregate, aggregate, e, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	return r
+}
+
+func TestFlushKeepsAggregateOrder(t *testing.T) {
+	ctx := context.Background()
+	source := newMemory(
+		record(t, "ord_1", events.OrderCreated{OrderID: "ord_1"}),
+		record(t, "ord_2", events.OrderCreated{OrderID: "ord_2"}),
+		record(t, "ord_1", events.OrderCancelled{OrderID: "ord_1"}),
+	)
+	first := &recorder{name: "first"}
+	second := &recorder{name: "second", fail: map[uint64]bool{1: true}}
+	relay := NewRelay(source, []Sink{first, second}, Options{})
+
+	if err := relay.Flush(ctx); err == nil {
+		t.Fatalf("Expected the failure of the sink, but got none")
+	}
+	// ord_2 isn't held back by ord_1
+	if !slices.Equal(first.got, []uint64{1, 2}) || !slices.Equal(second.got, []uint64{2}) {
+		t.Errorf("Expected the records after the failed one of ord_1 to wait, but got %v and %v", first.got, second.got)
+	}
+	if n, _ := source.Stats(); n != 2 {
+		t.Errorf("Expected 2 pending records, but got %d", n)
+	}
+
+	second.fail = nil
+	if err := relay.Flush(ctx); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !slices.Equal(first.got, []uint64{1, 2, 3}) {
+		t.Errorf("Expected the sink that took the record not to get it again, but got %v", first.got)
+	}
+	if !slices.Equal(second.got, []uint64{2, 1, 3}) {
+		t.Errorf("Expected the records of ord_1 in order, but got %v", second.got)
+	}
+	if n, _ := source.Stats(); n != 0 {
+		t.Errorf("Expected no pending records, but got %d", n)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	source := newMemory()
+	sink := &recorder{name: "sink"}
+	relay := NewRelay(source, []Sink{sink}, Options{Interval: time.Hour, Batch: 2})
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	source.mu.Lock()
+	for i := range 5 {
+		source.pending = append(source.pending, Record{Seq: uint64(i + 1), Aggregate: "ord_1"})
+	}
+	source.mu.Unlock()
+	source.added <- struct{}{}
+
+	// the notification is enough, the interval is an hour
+	deadline := time.Now().Add(5 * time.Second)
+	for n, _ := source.Stats(); n != 0; n, _ = source.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the records to be relayed, but %d are pending", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if !slices.Equal(sink.got, []uint64{1, 2, 3, 4, 5}) {
+		t.Errorf("Expected every record in order, but got %v", sink.got)
+	}
+}
+
+func TestBusSink(t *testing.T) {
+	ctx := context.Background()
+	bus := events.New(events.Options{})
+	var got []events.Delivery[events.OrderCreated]
+	events.Subscribe(bus, "test", func(ctx context.Context, d events.Delivery[events.OrderCreated]) error {
+		got = append(got, d)
+		return nil
+	}, events.SubscribeOptions{})
+
+	created := events.OrderCreated{OrderID: "ord_1", UserID: "usr_1", Total: 500, Currency: "USD"}
+	if err := NewBusSink(bus).Send(ctx, record(t, "ord_1", created)); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	bus.Close(ctx)
+	if len(got) != 1 || got[0].Event != created || got[0].ID != "evt_ord_1" {
+		t.Errorf("Expected the event with the id of the record, but got %+v", got)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+	sink, err := OpenFileSink(path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	source := newMemory(
+		record(t, "ord_1", events.OrderCreated{OrderID: "ord_1"}),
+		record(t, "ord_1", events.OrderCancelled{OrderID: "ord_1"}),
+	)
+	if err := NewRelay(source, []Sink{sink}, Options{}).Flush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	sink.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer f.Close()
+	var types []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Expected a record per line, but got %q: %v", scanner.Text(), err)
+		}
+		types = append(types, r.Type)
+	}
+	if !slices.Equal(types, []string{"order.created", "order.cancelled"}) {
+		t.Errorf("Expected the records in order, but got %v", types)
+	}
+}
@@ -0,0 +1,23 @@
+package routers
+
+import (
+	"net/http"
+
+	"go-learning/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GatewayRouter hands every request of the group to the gRPC gateway,
+// which routes it from the google.api.http annotations of the protos.
+func GatewayRouter(routerGroup *gin.RouterGroup, gateway http.Handler) {
+	serve := func(c *gin.Context) {
+		// the services log the same request id as the access log
+		c.Request.Header.Set(middleware.RequestIDHeader, c.GetString(middleware.RequestIDKey))
+		gateway.ServeHTTP(c.Writer, c.Request)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		routerGroup.Handle(method, "/*path", serve)
+	}
+}
@@ -0,0 +1,20 @@
+package routers
+
+import (
+	orderhandlers "go-learning/internal/handlers"
+	orderpb "go-learning/pkg/grpc/order"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrderRouter serves the v1 order routes over the OrderService
+// implementation.
+func OrderRouter(routerGroup *gin.RouterGroup, orderService orderpb.OrderServiceServer) *gin.RouterGroup {
+	orders := routerGroup.Group("/orders")
+	orders.POST("", orderhandlers.CreateOrder(orderService))
+	orders.GET("", orderhandlers.ListOrders(orderService))
+	orders.GET("/:id", orderhandlers.GetOrder(orderService))
+	orders.POST("/:id/cancel", orderhandlers.CancelOrder(orderService))
+
+	return orders
+}
@@ -2,15 +2,20 @@ package routers
 
 import (
 	userhandlers "go-learning/internal/handlers"
+	orderpb "go-learning/pkg/grpc/order"
+	userpb "go-learning/pkg/grpc/user"
 
 	"github.com/gin-gonic/gin"
 )
 
-func UserRouter(routerGroup *gin.RouterGroup) *gin.RouterGroup {
+// UserRouter serves the v1 user routes over the UserService implementation,
+// and the orders of a user over the OrderService one.
+func UserRouter(routerGroup *gin.RouterGroup, userService userpb.UserServiceServer, orderService orderpb.OrderServiceServer) *gin.RouterGroup {
 	users := routerGroup.Group("/users")
-	users.POST("", userhandlers.New())
-	users.GET("", userhandlers.GetList())
-	users.GET("/:id", userhandlers.GetById())
+	users.POST("", userhandlers.New(userService))
+	users.GET("", userhandlers.GetList(userService))
+	users.GET("/:id", userhandlers.GetById(userService))
+	users.GET("/:id/orders", userhandlers.GetUserOrders(orderService))
 
 	return users
 }
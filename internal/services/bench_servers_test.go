@@ -0,0 +1,11 @@
+package services
+
+import "go-learning/internal/orders"
+
+// newBenchServers returns the servers the benchmarks run, over fresh
+// stores. It's on its own so scripts/bench-compare.sh can replace it with
+// the constructors of older revisions and run the same benchmarks there.
+func newBenchServers() (*UserServer, *OrderServer, *ProductServer) {
+	stores := NewStores()
+	return NewUserServer(stores, 0), NewOrderServer(stores, orders.Pricing{}, 0), NewProductServer(stores)
+}
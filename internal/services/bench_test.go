@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
+)
+
+// benchSKUs keeps the skus of the fixtures apart, the catalog rejects
+// duplicates.
+var benchSKUs atomic.Int64
+
+// benchFixture is a set of servers seeded with users, products and orders.
+type benchFixture struct {
+	users    *UserServer
+	orders   *OrderServer
+	products *ProductServer
+	userIDs  []string
+	orderIDs []string
+	product  string
+}
+
+func newBenchFixture(b *testing.B) *benchFixture {
+	b.Helper()
+	ctx := context.Background()
+	f := &benchFixture{}
+	f.users, f.orders, f.products = newBenchServers()
+	b.Cleanup(f.orders.Close)
+
+	product, err := f.products.CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: fmt.Sprintf("BENCH-%d", benchSKUs.Add(1)), Name: "Bench", Price: &common.Money{Amount: 100, Currency: "USD"}, Stock: 1 << 40,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	f.product = product.GetId()
+
+	for i := range 100 {
+		user, err := f.users.CreateUser(ctx, &userpb.CreateUserRequest{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.userIDs = append(f.userIDs, user.GetId())
+		order, err := f.createOrder(ctx, i)
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.orderIDs = append(f.orderIDs, order.GetId())
+	}
+	return f
+}
+
+func (f *benchFixture) createOrder(ctx context.Context, i int) (*orderpb.CreateOrderReply, error) {
+	return f.orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId: f.userIDs[i%len(f.userIDs)],
+		Items:  []*orderpb.OrderItem{{ProductId: f.product, Quantity: 1}},
+	})
+}
+
+// runParallel spreads b.N calls of op over the goroutines, each call gets
+// its own index so the load spreads over the seeded ids.
+func runParallel(b *testing.B, op func(ctx context.Context, i int) error) {
+	ctx := context.Background()
+	var n atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := op(ctx, int(n.Add(1))); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGetUser(b *testing.B) {
+	f := newBenchFixture(b)
+	runParallel(b, func(ctx context.Context, i int) error {
+		_, err := f.users.GetUser(ctx, &userpb.GetUserRequest{Id: f.userIDs[i%len(f.userIDs)]})
+		return err
+	})
+}
+
+func BenchmarkGetOrder(b *testing.B) {
+	f := newBenchFixture(b)
+	runParallel(b, func(ctx context.Context, i int) error {
+		_, err := f.orders.GetOrder(ctx, &orderpb.GetOrderRequest{Id: f.orderIDs[i%len(f.orderIDs)]})
+		return err
+	})
+}
+
+func BenchmarkCreateOrder(b *testing.B) {
+	f := newBenchFixture(b)
+	runParallel(b, func(ctx context.Context, i int) error {
+		_, err := f.createOrder(ctx, i)
+		return err
+	})
+}
+
+// BenchmarkMixed is the load the shared lock hurt the most: mostly user
+// and order reads, with one order written every ten calls.
+func BenchmarkMixed(b *testing.B) {
+	f := newBenchFixture(b)
+	runParallel(b, func(ctx context.Context, i int) error {
+		var err error
+		switch i % 10 {
+		case 0:
+			_, err = f.createOrder(ctx, i)
+		case 1, 2, 3, 4, 5:
+			_, err = f.users.GetUser(ctx, &userpb.GetUserRequest{Id: f.userIDs[i%len(f.userIDs)]})
+		default:
+			_, err = f.orders.GetOrder(ctx, &orderpb.GetOrderRequest{Id: f.orderIDs[i%len(f.orderIDs)]})
+		}
+		return err
+	})
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-learning/internal/gateway"
+	"go-learning/internal/idempotency"
+	"go-learning/internal/validation"
+	"go-learning/pkg/auth"
+	common "go-learning/pkg/grpc/common"
+	"go-learning/pkg/id"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// notFound reports a missing resource with a ResourceInfo detail, so
+// clients can tell which resource was missing without parsing messages.
+func notFound(resourceType, id string) error {
+	st := status.Newf(codes.NotFound, "%s %q not found", resourceType, id)
+	return withDetails(st, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: id,
+		Description:  fmt.Sprintf("%s not found", resourceType),
+	})
+}
+
+// alreadyExists reports a unique attribute taken by another resource.
+func alreadyExists(resourceType, name, description string) error {
+	st := status.New(codes.AlreadyExists, description)
+	return withDetails(st, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: name,
+		Description:  description,
+	})
+}
+
+// referenceNotFound reports a request field pointing to a missing
+// resource, e.g. an order for a user that doesn't exist.
+func referenceNotFound(field, resourceType, id string) error {
+	st := status.Newf(codes.NotFound, "%s %q not found", resourceType, id)
+	return withDetails(st,
+		&errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: id, Description: fmt.Sprintf("%s not found", resourceType)},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: fmt.Sprintf("%s %q does not exist", resourceType, id)},
+		}},
+	)
+}
+
+// invalidField reports a request field with an invalid value.
+func invalidField(field, description string) error {
+	st := status.Newf(codes.InvalidArgument, "invalid %s: %s", field, description)
+	return withDetails(st, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: description},
+		},
+	})
+}
+
+// validateID reports a malformed id as an invalid field, before looking
+// anything up.
+func validateID(field string, prefix id.Prefix, s string) error {
+	if err := id.Validate(prefix, s); err != nil {
+		return invalidField(field, err.Error())
+	}
+	return nil
+}
+
+// maxRequestIDLength bounds the request ids kept for deduplication.
+const maxRequestIDLength = 128
+
+// dedup runs create at most once per request_id of the caller. The key is
+// scoped to the authenticated subject so clients can't see each other's
+// replies, and the request is compared without its request_id.
+func dedup[R proto.Message](ctx context.Context, store *idempotency.Store[R], requestID string, req proto.Message, create func() (R, error)) (R, error) {
+	var zero R
+	if len(requestID) > maxRequestIDLength {
+		return zero, invalidField("request_id", fmt.Sprintf("must be at most %d characters", maxRequestIDLength))
+	}
+
+	key := requestID
+	if claims, ok := auth.FromContext(ctx); ok && requestID != "" {
+		key = claims.Subject + "/" + requestID
+	}
+
+	payload := proto.Clone(req)
+	payload.ProtoReflect().Clear(payload.ProtoReflect().Descriptor().Fields().ByName("request_id"))
+
+	reply, err := store.Do(key, payload, create)
+	if errors.Is(err, idempotency.ErrConflict) {
+		return zero, alreadyExists("request", requestID, "request_id was already used for a different request")
+	}
+	return reply, err
+}
+
+// invalidRequest turns validation errors into a single InvalidArgument
+// with one violation per field.
+func invalidRequest(err error) error {
+	return fieldViolations(codes.InvalidArgument, "invalid request", err)
+}
+
+// fieldViolations reports the validation errors in err under the given
+// code, e.g. NotFound when a field references a missing resource.
+func fieldViolations(code codes.Code, message string, err error) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, fieldErr := range validation.FieldErrors(err) {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldErr.Field,
+			Description: fieldErr.Err.Error(),
+		})
+	}
+	if len(badRequest.FieldViolations) == 0 {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	st := status.New(code, message+": "+strings.ReplaceAll(err.Error(), "\n", "; "))
+	return withDetails(st, badRequest)
+}
+
+// failedPrecondition reports an operation the resource's current state
+// doesn't allow, e.g. cancelling a shipped order.
+func failedPrecondition(resourceType, id, description string) error {
+	st := status.New(codes.FailedPrecondition, description)
+	return withDetails(st, &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{
+			{Type: "STATE", Subject: resourceType + "/" + id, Description: description},
+		},
+	})
+}
+
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) error {
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		// details are best effort, the code and message are what matters
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// LegacyResponseStatusInterceptor keeps old clients working while they
+// migrate to status codes: errors are turned back into a successful reply
+// carrying a common.ResponseStatus, like the services used to do.
+func LegacyResponseStatusInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+
+	reply, ok := newReply(info.FullMethod)
+	if !ok {
+		return nil, err
+	}
+	field := reply.ProtoReflect().Descriptor().Fields().ByName("status")
+	if field == nil || field.Message() == nil || field.Message().FullName() != "common.ResponseStatus" {
+		return nil, err
+	}
+
+	st := status.Convert(err)
+	legacy := &common.ResponseStatus{Code: int32(gateway.HTTPStatusFromCode(st.Code())), Message: st.Message()}
+	reply.ProtoReflect().Set(field, protoreflect.ValueOfMessage(legacy.ProtoReflect()))
+	return reply, nil
+}
+
+// newReply returns an empty reply message for a method such as
+// "/user.UserService/GetUser", looked up in the generated descriptors.
+func newReply(fullMethod string) (proto.Message, bool) {
+	// "/pkg.Service/Method" -> "pkg.Service.Method"
+	name := strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1)
+
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, false
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, false
+	}
+	msgType, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, false
+	}
+	return msgType.New().Interface(), true
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc"
+)
+
+func TestLegacyResponseStatusInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUser"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return nil, notFound("user", "u42")
+	}
+
+	resp, err := LegacyResponseStatusInterceptor(context.Background(), &userpb.GetUserRequest{Id: "u42"}, info, handler)
+	if err != nil {
+		t.Fatalf("Expected the error to be moved into the reply, but got %v", err)
+	}
+
+	reply, ok := resp.(*userpb.GetUserReply)
+	if !ok {
+		t.Fatalf("Expected a *userpb.GetUserReply, but got %T", resp)
+	}
+	if reply.GetStatus().GetCode() != 404 {
+		t.Errorf("Expected status code 404, but got %v", reply.GetStatus().GetCode())
+	}
+	if reply.GetStatus().GetMessage() != `user "u42" not found` {
+		t.Errorf("Expected not found message, but got %q", reply.GetStatus().GetMessage())
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-learning/internal/catalog"
+	"go-learning/internal/config"
+	"go-learning/internal/orders"
+	"go-learning/internal/outbox"
+	"go-learning/internal/wal"
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// StoreOptions configures the stores opened with OpenStores.
+type StoreOptions struct {
+	WAL wal.Options
+	// SnapshotInterval is how often the journal is compacted into a
+	// snapshot, 0 only snapshots on Close.
+	SnapshotInterval time.Duration
+}
+
+// change is a journal record. It holds the new state of everything a
+// mutation touched rather than the mutation itself, so replaying it is
+// just storing those values. A snapshot is a change holding everything.
+type change struct {
+	Users           []journaledUser   `json:"users,omitempty"`
+	DeletedUsers    []string          `json:"deleted_users,omitempty"`
+	Products        []catalog.Product `json:"products,omitempty"`
+	DeletedProducts []string          `json:"deleted_products,omitempty"`
+	Orders          []*orders.Order   `json:"orders,omitempty"`
+	Outbox          []outbox.Record   `json:"outbox,omitempty"`
+	Delivered       []uint64          `json:"delivered,omitempty"`
+	// OutboxSeq is the last outbox sequence, in snapshots, so they aren't
+	// reused once the records are delivered.
+	OutboxSeq uint64 `json:"outbox_seq,omitempty"`
+}
+
+// journaledUser encodes a stored user with protojson, encoding/json
+// doesn't handle generated messages.
+type journaledUser struct {
+	*userpb.GetUserReply
+}
+
+func (u journaledUser) MarshalJSON() ([]byte, error) {
+	return protojson.Marshal(u.GetUserReply)
+}
+
+func (u *journaledUser) UnmarshalJSON(b []byte) error {
+	u.GetUserReply = &userpb.GetUserReply{}
+	return protojson.Unmarshal(b, u.GetUserReply)
+}
+
+// journal writes the changes of the stores to a write-ahead log. The
+// stores write under their own lock, so the changes to a given user,
+// product or order are logged in the order they're applied.
+type journal struct {
+	log     *wal.Log
+	written atomic.Int64 // changes since the last snapshot
+
+	snapshotMu sync.Mutex // one snapshot at a time
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// write logs a change before the store applies it. Nothing is logged for
+// in-memory stores, which have no journal. Once an fsync failed every write
+// fails, until the stores are reopened.
+func (j *journal) write(c *change) error {
+	if j == nil {
+		return nil
+	}
+	b, err := json.Marshal(c)
+	if err == nil {
+		err = j.log.Append(b)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "saving the change: %v", err)
+	}
+	j.written.Add(1)
+	return nil
+}
+
+// OpenStores returns stores persisted in dir. The state is recovered from
+// the last snapshot and the journal written after it, a change torn by a
+// crash is dropped. Close must be called to release the files.
+//
+// Only the stores are persisted: after a restart the idempotency window
+// starts empty and order watchers have to list the orders again.
+func OpenStores(dir string, opts StoreOptions) (*Stores, error) {
+	s := NewStores()
+	restore := func(b []byte) error {
+		var c change
+		if err := json.Unmarshal(b, &c); err != nil {
+			return err
+		}
+		s.apply(&c)
+		return nil
+	}
+	var replayed int64
+	apply := func(b []byte) error {
+		replayed++
+		return restore(b)
+	}
+	l, err := wal.Open(dir, opts.WAL, restore, apply)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{log: l, stop: make(chan struct{}), done: make(chan struct{})}
+	// the replayed changes are compacted by the next snapshot
+	j.written.Store(replayed)
+	s.journal = j
+	s.Users.journal, s.Products.journal, s.Orders.journal, s.Outbox.journal = j, j, j, j
+
+	if opts.SnapshotInterval > 0 {
+		go s.snapshotLoop(opts.SnapshotInterval)
+	} else {
+		close(j.done)
+	}
+	return s, nil
+}
+
+// Open opens the stores persisted in cfg.Dir, or in-memory ones without a
+// directory, as the servers configure them.
+func Open(cfg config.StoreConfig) (*Stores, error) {
+	if cfg.Dir == "" {
+		slog.Warn("STORE_DIR not set, users, products and orders are lost on restart")
+		return NewStores(), nil
+	}
+	policy, err := wal.ParseSyncPolicy(cfg.Sync)
+	if err != nil {
+		return nil, err
+	}
+	stores, err := OpenStores(cfg.Dir, StoreOptions{
+		WAL:              wal.Options{Sync: policy, SyncInterval: cfg.SyncInterval},
+		SnapshotInterval: cfg.SnapshotInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("stores opened", slog.String("dir", cfg.Dir), slog.String("sync", cfg.Sync))
+	return stores, nil
+}
+
+// apply stores the values of a change, while opening the stores.
+func (s *Stores) apply(c *change) {
+	for _, user := range c.Users {
+		s.Users.users[user.GetId()] = user.GetUserReply
+	}
+	for _, userID := range c.DeletedUsers {
+		delete(s.Users.users, userID)
+	}
+	for _, product := range c.Products {
+		s.Products.products[product.ID] = &product
+	}
+	for _, productID := range c.DeletedProducts {
+		delete(s.Products.products, productID)
+	}
+	for _, order := range c.Orders {
+		s.Orders.orders[order.ID] = order
+	}
+	s.Outbox.pending = append(s.Outbox.pending, c.Outbox...)
+	s.Outbox.drop(c.Delivered)
+	s.Outbox.seq = max(s.Outbox.seq, c.OutboxSeq)
+	if len(s.Outbox.pending) > 0 {
+		s.Outbox.seq = max(s.Outbox.seq, s.Outbox.pending[len(s.Outbox.pending)-1].Seq)
+	}
+}
+
+// Snapshot compacts the journal: the current state is written to a
+// snapshot and the changes it includes are deleted. It does nothing for
+// in-memory stores, or when nothing changed since the last snapshot.
+func (s *Stores) Snapshot() error {
+	if s.journal == nil {
+		return nil
+	}
+	s.journal.snapshotMu.Lock()
+	defer s.journal.snapshotMu.Unlock()
+
+	if s.journal.written.Load() == 0 {
+		return nil
+	}
+	state, next, written, err := s.capture()
+	if err == nil {
+		err = s.journal.log.WriteSnapshot(state, next)
+	}
+	if err != nil {
+		// the changes are still only in the journal, try again next time
+		s.journal.written.Add(written)
+	}
+	return err
+}
+
+// capture encodes the state and starts a new journal segment, holding every
+// store so no change falls in between. It returns how many changes the
+// state includes since the last snapshot.
+func (s *Stores) capture() ([]byte, uint64, int64, error) {
+	s.Orders.mu.RLock()
+	defer s.Orders.mu.RUnlock()
+	s.Products.mu.RLock()
+	defer s.Products.mu.RUnlock()
+	s.Users.mu.RLock()
+	defer s.Users.mu.RUnlock()
+	s.Outbox.mu.Lock()
+	defer s.Outbox.mu.Unlock()
+
+	next, err := s.journal.log.Rotate()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	written := s.journal.written.Swap(0)
+
+	var state change
+	for _, user := range s.Users.users {
+		state.Users = append(state.Users, journaledUser{user})
+	}
+	for _, product := range s.Products.products {
+		state.Products = append(state.Products, *product)
+	}
+	for _, order := range s.Orders.orders {
+		state.Orders = append(state.Orders, order)
+	}
+	state.Outbox = s.Outbox.pending
+	state.OutboxSeq = s.Outbox.seq
+	b, err := json.Marshal(&state)
+	return b, next, written, err
+}
+
+func (s *Stores) snapshotLoop(interval time.Duration) {
+	defer close(s.journal.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.journal.stop:
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				slog.Error("failed to snapshot the stores", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Close takes a last snapshot, so the next start has nothing to replay,
+// and closes the journal. It does nothing for in-memory stores.
+func (s *Stores) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	close(s.journal.stop)
+	<-s.journal.done
+
+	err := s.Snapshot()
+	if closeErr := s.journal.log.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
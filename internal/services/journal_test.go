@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go-learning/internal/orders"
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// persisted is what a test reads back after reopening the stores.
+type persisted struct {
+	user, deleted, product, placed, cancelled string
+}
+
+// fill makes one of each change through the services.
+func fill(t *testing.T, stores *Stores) persisted {
+	t.Helper()
+	ctx := context.Background()
+	users := NewUserServer(stores, 0)
+	products := NewProductServer(stores)
+	s := NewOrderServer(stores, orders.Pricing{}, 0)
+	defer s.Close()
+
+	var p persisted
+	user, _ := users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Durable", Email: "durable@example.com"})
+	users.UpdateUser(ctx, &userpb.UpdateUserRequest{Id: user.GetId(), Name: "Renamed", Email: "durable@example.com"})
+	deleted, _ := users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Gone", Email: "gone@example.com"})
+	users.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: deleted.GetId()})
+	product, _ := products.CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "DISK-001", Name: "Disk", Price: &common.Money{Amount: 100, Currency: "USD"}, Stock: 10,
+	})
+	item := []*orderpb.OrderItem{{ProductId: product.GetId(), Quantity: 3}}
+	placed, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: user.GetId(), Items: item})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	s.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: placed.GetId()})
+	cancelled, _ := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: user.GetId(), Items: item})
+	s.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: cancelled.GetId()})
+
+	p.user, p.deleted, p.product = user.GetId(), deleted.GetId(), product.GetId()
+	p.placed, p.cancelled = placed.GetId(), cancelled.GetId()
+	return p
+}
+
+// replies reads back everything fill wrote.
+func replies(t *testing.T, stores *Stores, p persisted) []proto.Message {
+	t.Helper()
+	ctx := context.Background()
+	users := NewUserServer(stores, 0)
+	s := NewOrderServer(stores, orders.Pricing{}, 0)
+	defer s.Close()
+
+	if _, err := users.GetUser(ctx, &userpb.GetUserRequest{Id: p.deleted}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected the deleted user to stay deleted, but got %v", err)
+	}
+	user, _ := users.GetUser(ctx, &userpb.GetUserRequest{Id: p.user})
+	product, _ := NewProductServer(stores).GetProduct(ctx, &productpb.GetProductRequest{Id: p.product})
+	placed, _ := s.GetOrder(ctx, &orderpb.GetOrderRequest{Id: p.placed})
+	cancelled, _ := s.GetOrder(ctx, &orderpb.GetOrderRequest{Id: p.cancelled})
+	return []proto.Message{user, product, placed, cancelled}
+}
+
+func TestOpenStores(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		close func(*Stores)
+	}{
+		// nothing but the journal, as after a crash
+		{"journal", func(*Stores) {}},
+		{"snapshot", func(s *Stores) { s.Close() }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stores, err := OpenStores(dir, StoreOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			p := fill(t, stores)
+			want := replies(t, stores, p)
+			tc.close(stores)
+
+			reopened, err := OpenStores(dir, StoreOptions{})
+			if err != nil {
+				t.Fatalf("Expected the stores to reopen, but got %v", err)
+			}
+			defer reopened.Close()
+			got := replies(t, reopened, p)
+			for i := range want {
+				if !proto.Equal(got[i], want[i]) {
+					t.Errorf("Expected %v, but got %v", want[i], got[i])
+				}
+			}
+			if product := got[1].(*productpb.GetProductReply); product.GetStock() != 7 {
+				t.Errorf("Expected the cancelled order to give its stock back, but got %d left", product.GetStock())
+			}
+		})
+	}
+}
+
+// TestSnapshotThenJournal reopens stores whose state is split between a
+// snapshot and the changes made after it.
+func TestSnapshotThenJournal(t *testing.T) {
+	dir := t.TempDir()
+	stores, _ := OpenStores(dir, StoreOptions{})
+	p := fill(t, stores)
+	if err := stores.Snapshot(); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	NewUserServer(stores, 0).UpdateUser(context.Background(), &userpb.UpdateUserRequest{Id: p.user, Name: "After", Email: "after@example.com"})
+
+	reopened, err := OpenStores(dir, StoreOptions{})
+	if err != nil {
+		t.Fatalf("Expected the stores to reopen, but got %v", err)
+	}
+	defer reopened.Close()
+	user := replies(t, reopened, p)[0].(*userpb.GetUserReply)
+	if user.GetName() != "After" {
+		t.Errorf("Expected the change made after the snapshot, but got %v", user)
+	}
+}
+
+// TestOutboxJournal checks that the outbox records are journaled with the
+// orders and their delivery, and that a change that couldn't be saved
+// leaves no record.
+func TestOutboxJournal(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		close func(*Stores)
+	}{
+		{"journal", func(*Stores) {}},
+		{"snapshot", func(s *Stores) { s.Close() }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stores, _ := OpenStores(dir, StoreOptions{})
+			p := fill(t, stores)
+			// placed, cancelled created, then cancelled
+			if err := stores.Outbox.MarkDelivered([]uint64{1}); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			tc.close(stores)
+
+			reopened, err := OpenStores(dir, StoreOptions{})
+			if err != nil {
+				t.Fatalf("Expected the stores to reopen, but got %v", err)
+			}
+			pending := reopened.Outbox.Pending(10)
+			want := []string{"order.created", "order.cancelled"}
+			if len(pending) != len(want) {
+				t.Fatalf("Expected %d pending records, but got %v", len(want), pending)
+			}
+			for i, record := range pending {
+				if record.Seq != uint64(i+2) || record.Type != want[i] || record.Aggregate != p.cancelled {
+					t.Errorf("Expected record %d to be the %s of %s, but got %+v", i+2, want[i], p.cancelled, record)
+				}
+			}
+
+			reopened.Close()
+			s := NewOrderServer(reopened, orders.Pricing{}, 0)
+			defer s.Close()
+			_, err = s.CreateOrder(context.Background(), &orderpb.CreateOrderRequest{
+				UserId: p.user, Items: []*orderpb.OrderItem{{ProductId: p.product, Quantity: 1}},
+			})
+			if status.Code(err) != codes.Internal {
+				t.Errorf("Expected the order not to be saved, but got %v", err)
+			}
+			if n, _ := reopened.Outbox.Stats(); n != len(want) {
+				t.Errorf("Expected no record for the order that wasn't saved, but got %d pending", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-learning/internal/broadcast"
+	"go-learning/internal/idempotency"
+	"go-learning/internal/orders"
+	"go-learning/internal/outbox"
+	"go-learning/pkg/events"
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	"go-learning/pkg/id"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var stateToProto = map[orders.State]orderpb.OrderState{
+	orders.StatePending:   orderpb.OrderState_ORDER_STATE_PENDING,
+	orders.StatePaid:      orderpb.OrderState_ORDER_STATE_PAID,
+	orders.StateShipped:   orderpb.OrderState_ORDER_STATE_SHIPPED,
+	orders.StateDelivered: orderpb.OrderState_ORDER_STATE_DELIVERED,
+	orders.StateCancelled: orderpb.OrderState_ORDER_STATE_CANCELLED,
+	orders.StateRefunded:  orderpb.OrderState_ORDER_STATE_REFUNDED,
+}
+
+const (
+	// watchHistory is how many events a reconnecting watcher can catch up on
+	watchHistory = 1000
+	// watchBuffer is how many events a watcher can lag behind before it's dropped
+	watchBuffer = 64
+)
+
+type OrderServer struct {
+	orderpb.UnimplementedOrderServiceServer
+	orders   *OrderStore
+	users    *UserStore
+	products *ProductStore
+	pricing  orders.Pricing
+	now      func() time.Time
+	ids      *id.Generator
+	created  *idempotency.Store[*orderpb.CreateOrderReply]
+	events   *broadcast.Broker[orderEvent]
+}
+
+// orderEvent is published on every change. The order is converted to its
+// reply right away, so watchers share a snapshot nobody modifies.
+type orderEvent struct {
+	kind  orderpb.OrderEventType
+	order *orderpb.GetOrderReply
+	at    time.Time
+}
+
+func (s *OrderServer) GetOrder(ctx context.Context, req *orderpb.GetOrderRequest) (*orderpb.GetOrderReply, error) {
+	if err := validateID("id", id.Order, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	var reply *orderpb.GetOrderReply
+	if !s.orders.view(req.GetId(), func(order *orders.Order) { reply = toOrderReply(order) }) {
+		return nil, notFound("order", req.GetId())
+	}
+	return reply, nil
+}
+
+// CreateOrder creates an order, once per request_id: a retry gets the
+// reply of the first request instead of ordering twice.
+func (s *OrderServer) CreateOrder(ctx context.Context, req *orderpb.CreateOrderRequest) (*orderpb.CreateOrderReply, error) {
+	return dedup(ctx, s.created, req.GetRequestId(), req, func() (*orderpb.CreateOrderReply, error) {
+		return s.createOrder(req)
+	})
+}
+
+func (s *OrderServer) createOrder(req *orderpb.CreateOrderRequest) (*orderpb.CreateOrderReply, error) {
+	orderReq := orders.Request{
+		UserID:     req.GetUserId(),
+		ProductIDs: req.GetProductIds(),
+	}
+	for _, item := range req.GetItems() {
+		orderReq.Items = append(orderReq.Items, orders.Item{ProductID: item.GetProductId(), Quantity: item.GetQuantity()})
+	}
+
+	if err := orderReq.Validate(); err != nil {
+		return nil, invalidRequest(err)
+	}
+	if _, exists := s.users.get(req.GetUserId()); !exists {
+		return nil, referenceNotFound("user_id", "user", req.GetUserId())
+	}
+
+	// the stock is reserved along with the pricing, it's given back if the
+	// order is cancelled
+	orderID := s.ids.New(id.Order)
+	err := s.orders.create(func(lookup orders.ProductLookup) (*orders.Order, error) {
+		return orders.New(orderID, orderReq, lookup, s.pricing, s.now())
+	}, s.record(func(order *orders.Order) events.Event {
+		return events.OrderCreated{OrderID: order.ID, UserID: order.UserID, Total: order.Total.Amount, Currency: order.Total.Currency}
+	}), func(order *orders.Order) {
+		s.publish(orderpb.OrderEventType_ORDER_EVENT_TYPE_CREATED, order)
+	})
+	switch {
+	case errors.Is(err, orders.ErrUnknownProduct):
+		return nil, fieldViolations(codes.NotFound, "unknown products", err)
+	case errors.Is(err, orders.ErrOutOfStock):
+		return nil, fieldViolations(codes.FailedPrecondition, "not enough stock", err)
+	case status.Code(err) == codes.Internal:
+		// the order was priced but couldn't be saved
+		return nil, err
+	case err != nil:
+		return nil, invalidRequest(err)
+	}
+
+	return &orderpb.CreateOrderReply{
+		Id:     orderID,
+		Status: &common.ResponseStatus{Code: 201, Message: "Order created successfully"},
+	}, nil
+}
+
+func (s *OrderServer) CancelOrder(ctx context.Context, req *orderpb.CancelOrderRequest) (*orderpb.GetOrderReply, error) {
+	return s.cancel(req.GetId())
+}
+
+// cancel cancels an order, whether through CancelOrder or AdvanceOrder.
+// The stock of a cancelled order is given back.
+func (s *OrderServer) cancel(orderID string) (*orderpb.GetOrderReply, error) {
+	return s.transition(orderID, true, func(order *orders.Order, now time.Time) error {
+		return order.Cancel(now)
+	}, s.record(func(order *orders.Order) events.Event {
+		return events.OrderCancelled{OrderID: order.ID, UserID: order.UserID}
+	}))
+}
+
+func (s *OrderServer) AdvanceOrder(ctx context.Context, req *orderpb.AdvanceOrderRequest) (*orderpb.GetOrderReply, error) {
+	if req.GetTargetState() == orderpb.OrderState_ORDER_STATE_UNSPECIFIED {
+		return s.transition(req.GetId(), false, func(order *orders.Order, now time.Time) error {
+			return order.Advance(now)
+		}, nil)
+	}
+
+	target, ok := stateFromProto(req.GetTargetState())
+	if !ok {
+		return nil, invalidField("target_state", fmt.Sprintf("unknown state %v", req.GetTargetState()))
+	}
+	if target == orders.StateCancelled {
+		return s.cancel(req.GetId())
+	}
+	return s.transition(req.GetId(), false, func(order *orders.Order, now time.Time) error {
+		return order.Transition(target, now)
+	}, nil)
+}
+
+func (s *OrderServer) ListOrdersByUser(ctx context.Context, req *orderpb.ListOrdersByUserRequest) (*orderpb.ListOrdersByUserReply, error) {
+	if err := validateID("user_id", id.User, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	reply := &orderpb.ListOrdersByUserReply{
+		Status: &common.ResponseStatus{Code: 200, Message: "OK"},
+	}
+	s.orders.byUser(req.GetUserId(), func(order *orders.Order) {
+		reply.Orders = append(reply.Orders, toOrderReply(order))
+	})
+	return reply, nil
+}
+
+// transition applies a lifecycle change to a stored order. Changes the
+// state machine doesn't allow are reported as FailedPrecondition, the
+// client has to look at the current state before retrying. With
+// releaseStock, the stock reserved by the order is given back. record, if
+// not nil, returns the outbox record of the change.
+func (s *OrderServer) transition(orderID string, releaseStock bool, apply func(*orders.Order, time.Time) error, record recordFunc) (*orderpb.GetOrderReply, error) {
+	if err := validateID("id", id.Order, orderID); err != nil {
+		return nil, err
+	}
+
+	var reply *orderpb.GetOrderReply
+	err := s.orders.update(orderID, releaseStock, func(order *orders.Order) error {
+		if err := apply(order, s.now()); err != nil {
+			if errors.Is(err, orders.ErrInvalidTransition) {
+				return failedPrecondition("order", orderID, err.Error())
+			}
+			return status.Error(codes.Internal, err.Error())
+		}
+		return nil
+	}, record, func(order *orders.Order) {
+		reply = s.publish(orderpb.OrderEventType_ORDER_EVENT_TYPE_STATE_CHANGED, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// record returns the recordFunc of the domain event built by event. The
+// store writes it to the outbox with the change, the relay publishes it.
+func (s *OrderServer) record(event func(*orders.Order) events.Event) recordFunc {
+	return func(order *orders.Order) (outbox.Record, error) {
+		r, err := outbox.NewRecord(s.ids.New(id.Event), order.ID, event(order), s.now())
+		if err != nil {
+			return outbox.Record{}, status.Error(codes.Internal, err.Error())
+		}
+		return r, nil
+	}
+}
+
+// publish sends the change to the watchers and returns the reply of the
+// changed order. Callers hold the order store lock, so sequences follow
+// the order of changes.
+func (s *OrderServer) publish(kind orderpb.OrderEventType, order *orders.Order) *orderpb.GetOrderReply {
+	reply := toOrderReply(order)
+	s.events.Publish(orderEvent{
+		kind:  kind,
+		order: reply,
+		at:    order.History[len(order.History)-1].At,
+	})
+	return reply
+}
+
+// WatchOrders streams the events matching the request until the client
+// goes away. A watcher that can't keep up is disconnected with ABORTED and
+// resumes with the last sequence it received.
+func (s *OrderServer) WatchOrders(req *orderpb.WatchOrdersRequest, stream orderpb.OrderService_WatchOrdersServer) error {
+	if req.GetUserId() != "" {
+		if err := validateID("user_id", id.User, req.GetUserId()); err != nil {
+			return err
+		}
+	}
+	if req.GetOrderId() != "" {
+		if err := validateID("order_id", id.Order, req.GetOrderId()); err != nil {
+			return err
+		}
+	}
+
+	match := func(e orderEvent) bool {
+		return (req.GetUserId() == "" || e.order.GetUserId() == req.GetUserId()) &&
+			(req.GetOrderId() == "" || e.order.GetId() == req.GetOrderId())
+	}
+
+	sub, err := s.events.Subscribe(match, req.GetAfterSequence(), req.AfterSequence != nil)
+	switch {
+	case errors.Is(err, broadcast.ErrSequenceExpired):
+		return status.Errorf(codes.OutOfRange, "%v, list the orders again and watch without after_sequence", err)
+	case errors.Is(err, broadcast.ErrUnknownSequence):
+		return invalidField("after_sequence", err.Error())
+	case errors.Is(err, broadcast.ErrClosed):
+		return status.Error(codes.Unavailable, "server is shutting down")
+	case err != nil:
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer sub.Close()
+
+	last := req.GetAfterSequence()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				if errors.Is(sub.Err(), broadcast.ErrClosed) {
+					return status.Error(codes.Unavailable, "server is shutting down")
+				}
+				return status.Errorf(codes.Aborted, "%v, resume after sequence %d", sub.Err(), last)
+			}
+
+			if err := stream.Send(&orderpb.OrderEvent{
+				Sequence: event.Seq,
+				Type:     event.Value.kind,
+				Order:    event.Value.order,
+				At:       timestamppb.New(event.Value.at),
+			}); err != nil {
+				return err
+			}
+			last = event.Seq
+		}
+	}
+}
+
+// Close ends the watches, so a graceful stop doesn't wait for them.
+func (s *OrderServer) Close() {
+	s.events.Close()
+}
+
+func toOrderReply(order *orders.Order) *orderpb.GetOrderReply {
+	reply := &orderpb.GetOrderReply{
+		Id:     order.ID,
+		UserId: order.UserID,
+		// the float amount is only kept for old clients
+		Amount:     order.Total.Major(),
+		ProductIds: order.ProductIDs(),
+		Subtotal:   moneyToProto(order.Subtotal),
+		Discount:   moneyToProto(order.Discount),
+		Tax:        moneyToProto(order.Tax),
+		Total:      moneyToProto(order.Total),
+		State:      stateToProto[order.State],
+		Status:     &common.ResponseStatus{Code: 200, Message: "OK"},
+	}
+	for _, line := range order.Items {
+		reply.Items = append(reply.Items, &orderpb.LineItem{
+			ProductId: line.ProductID,
+			Sku:       line.SKU,
+			Quantity:  line.Quantity,
+			UnitPrice: moneyToProto(line.UnitPrice),
+			Total:     moneyToProto(line.Total),
+		})
+	}
+	for _, t := range order.History {
+		reply.History = append(reply.History, &orderpb.StateTransition{
+			State: stateToProto[t.State],
+			At:    timestamppb.New(t.At),
+		})
+	}
+	return reply
+}
+
+func stateFromProto(state orderpb.OrderState) (orders.State, bool) {
+	for domain, pb := range stateToProto {
+		if pb == state {
+			return domain, true
+		}
+	}
+	return "", false
+}
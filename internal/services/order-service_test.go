@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-learning/internal/orders"
+	"go-learning/internal/outbox"
+	"go-learning/pkg/events"
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// watchStream collects the events sent by WatchOrders.
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *orderpb.OrderEvent
+}
+
+func (s *watchStream) Context() context.Context { return s.ctx }
+
+func (s *watchStream) Send(event *orderpb.OrderEvent) error {
+	s.events <- event
+	return nil
+}
+
+// watch starts WatchOrders in the background, the returned channel gets
+// its result once ctx is cancelled.
+func watch(ctx context.Context, s *OrderServer, req *orderpb.WatchOrdersRequest) (*watchStream, chan error) {
+	stream := &watchStream{ctx: ctx, events: make(chan *orderpb.OrderEvent, 10)}
+	done := make(chan error, 1)
+	go func() { done <- s.WatchOrders(req, stream) }()
+	return stream, done
+}
+
+func next(t *testing.T, stream *watchStream) *orderpb.OrderEvent {
+	t.Helper()
+	select {
+	case event := <-stream.events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an order event, but got nothing")
+		return nil
+	}
+}
+
+func TestWatchOrders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stores := NewStores()
+	user, _ := NewUserServer(stores, 0).CreateUser(ctx, &userpb.CreateUserRequest{Name: "Watcher", Email: "watcher@example.com"})
+	product, _ := NewProductServer(stores).CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "WATCH-001", Name: "Watch", Price: &common.Money{Amount: 100, Currency: "USD"}, Stock: 10,
+	})
+	s := NewOrderServer(stores, orders.Pricing{}, 0)
+
+	// resuming from 0 replays the events published before the watch starts
+	stream, done := watch(ctx, s, &orderpb.WatchOrdersRequest{UserId: user.GetId(), AfterSequence: proto.Uint64(0)})
+
+	created, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: user.GetId(), ProductIds: []string{product.GetId()}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := s.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: created.GetId()}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	first := next(t, stream)
+	if first.GetType() != orderpb.OrderEventType_ORDER_EVENT_TYPE_CREATED || first.GetOrder().GetId() != created.GetId() {
+		t.Errorf("Expected a created event for %s, but got %v", created.GetId(), first)
+	}
+	second := next(t, stream)
+	if second.GetType() != orderpb.OrderEventType_ORDER_EVENT_TYPE_STATE_CHANGED || second.GetOrder().GetState() != orderpb.OrderState_ORDER_STATE_PAID {
+		t.Errorf("Expected the order to be paid, but got %v", second)
+	}
+	if second.GetSequence() != first.GetSequence()+1 {
+		t.Errorf("Expected consecutive sequences, but got %d and %d", first.GetSequence(), second.GetSequence())
+	}
+
+	// a client reconnecting after the first event only gets the second one
+	resumed, _ := watch(ctx, s, &orderpb.WatchOrdersRequest{OrderId: created.GetId(), AfterSequence: proto.Uint64(first.GetSequence())})
+	if event := next(t, resumed); event.GetSequence() != second.GetSequence() {
+		t.Errorf("Expected to resume at sequence %d, but got %d", second.GetSequence(), event.GetSequence())
+	}
+
+	s.Close()
+	if err := <-done; status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable once the server closes, but got %v", err)
+	}
+}
+
+func TestWatchOrdersUnknownSequence(t *testing.T) {
+	s := NewOrderServer(NewStores(), orders.Pricing{}, 0)
+	_, done := watch(context.Background(), s, &orderpb.WatchOrdersRequest{AfterSequence: proto.Uint64(42)})
+	if err := <-done; status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, but got %v", err)
+	}
+}
+
+func TestCreateOrderRequestID(t *testing.T) {
+	ctx := context.Background()
+	stores := NewStores()
+	user, _ := NewUserServer(stores, 0).CreateUser(ctx, &userpb.CreateUserRequest{Name: "Retrier", Email: "retrier@example.com"})
+	product, _ := NewProductServer(stores).CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "RETRY-001", Name: "Retry", Price: &common.Money{Amount: 100, Currency: "USD"}, Stock: 10,
+	})
+	s := NewOrderServer(stores, orders.Pricing{}, time.Minute)
+	req := &orderpb.CreateOrderRequest{
+		RequestId: "2c1f7a4e-retry",
+		UserId:    user.GetId(),
+		Items:     []*orderpb.OrderItem{{ProductId: product.GetId(), Quantity: 2}},
+	}
+
+	first, err := s.CreateOrder(ctx, req)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	retry, err := s.CreateOrder(ctx, proto.Clone(req).(*orderpb.CreateOrderRequest))
+	if err != nil || retry.GetId() != first.GetId() {
+		t.Errorf("Expected the retry to return order %s, but got %v, %v", first.GetId(), retry.GetId(), err)
+	}
+	if stored, _ := stores.Products.get(product.GetId()); stored.Stock != 8 {
+		t.Errorf("Expected the stock to be reserved once, but got %d left", stored.Stock)
+	}
+
+	changed := proto.Clone(req).(*orderpb.CreateOrderRequest)
+	changed.Items[0].Quantity = 3
+	if _, err := s.CreateOrder(ctx, changed); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists for a different payload, but got %v", err)
+	}
+
+	other := proto.Clone(req).(*orderpb.CreateOrderRequest)
+	other.RequestId = ""
+	if created, _ := s.CreateOrder(ctx, other); created.GetId() == first.GetId() {
+		t.Errorf("Expected a request without request_id to create another order")
+	}
+}
+
+// TestDomainEvents checks that each change is published once, retries
+// deduplicated by request_id included. The order events go through the
+// outbox.
+func TestDomainEvents(t *testing.T) {
+	ctx := context.Background()
+	bus := events.New(events.Options{})
+	var got []events.Event
+	events.Subscribe(bus, "test", func(ctx context.Context, d events.Delivery[events.Event]) error {
+		got = append(got, d.Event)
+		return nil
+	}, events.SubscribeOptions{})
+
+	stores := NewStores()
+	users := NewUserServer(stores, time.Minute, WithEvents(bus))
+	s := NewOrderServer(stores, orders.Pricing{}, time.Minute, WithEvents(bus))
+	defer s.Close()
+
+	createUser := &userpb.CreateUserRequest{Name: "Published", Email: "published@example.com", RequestId: "user-1"}
+	user, _ := users.CreateUser(ctx, createUser)
+	users.CreateUser(ctx, createUser)
+	product, _ := NewProductServer(stores, WithEvents(bus)).CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "EVT-001", Name: "Event", Price: &common.Money{Amount: 250, Currency: "USD"}, Stock: 10,
+	})
+	order, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId: user.GetId(), Items: []*orderpb.OrderItem{{ProductId: product.GetId(), Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	s.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: order.GetId()})
+	// a refused change publishes nothing
+	s.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: order.GetId()})
+
+	if pending, _ := stores.Outbox.Stats(); pending != 2 {
+		t.Errorf("Expected 2 records in the outbox, but got %d", pending)
+	}
+	relay := outbox.NewRelay(stores.Outbox, []outbox.Sink{outbox.NewBusSink(bus)}, outbox.Options{})
+	if err := relay.Flush(ctx); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if pending, _ := stores.Outbox.Stats(); pending != 0 {
+		t.Errorf("Expected the records to be delivered, but got %d pending", pending)
+	}
+	if err := bus.Close(ctx); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	want := []events.Event{
+		events.UserCreated{UserID: user.GetId(), Name: "Published", Email: "published@example.com"},
+		events.OrderCreated{OrderID: order.GetId(), UserID: user.GetId(), Total: 500, Currency: "USD"},
+		events.OrderCancelled{OrderID: order.GetId(), UserID: user.GetId()},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, but got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, but got %v", want[i], got[i])
+		}
+	}
+}
+
+// TestAdvanceToCancelled checks that cancelling through AdvanceOrder does
+// what CancelOrder does: the stock is given back and the event recorded in
+// the outbox, even once the client is gone.
+func TestAdvanceToCancelled(t *testing.T) {
+	ctx := context.Background()
+	stores := NewStores()
+	s := NewOrderServer(stores, orders.Pricing{}, 0)
+	defer s.Close()
+
+	user, _ := NewUserServer(stores, 0).CreateUser(ctx, &userpb.CreateUserRequest{Name: "Advance", Email: "advance@example.com"})
+	product, _ := NewProductServer(stores).CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "ADV-001", Name: "Advance", Price: &common.Money{Amount: 100, Currency: "USD"}, Stock: 10,
+	})
+	order, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId: user.GetId(), Items: []*orderpb.OrderItem{{ProductId: product.GetId(), Quantity: 3}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	reply, err := s.AdvanceOrder(cancelled, &orderpb.AdvanceOrderRequest{Id: order.GetId(), TargetState: orderpb.OrderState_ORDER_STATE_CANCELLED})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if reply.GetState() != orderpb.OrderState_ORDER_STATE_CANCELLED {
+		t.Errorf("Expected the order to be cancelled, but got %v", reply.GetState())
+	}
+	if stored, _ := stores.Products.get(product.GetId()); stored.Stock != 10 {
+		t.Errorf("Expected the stock to be given back, but got %d left", stored.Stock)
+	}
+	pending := stores.Outbox.Pending(10)
+	if len(pending) != 2 || pending[1].Type != (events.OrderCancelled{}).EventType() {
+		t.Errorf("Expected the cancellation in the outbox, but got %v", pending)
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-learning/internal/catalog"
+	"go-learning/internal/money"
+	common "go-learning/pkg/grpc/common"
+	productpb "go-learning/pkg/grpc/product"
+	"go-learning/pkg/id"
+)
+
+type ProductServer struct {
+	productpb.UnimplementedProductServiceServer
+	products *ProductStore
+	ids      *id.Generator
+}
+
+func (s *ProductServer) GetProduct(ctx context.Context, req *productpb.GetProductRequest) (*productpb.GetProductReply, error) {
+	if err := validateID("id", id.Product, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	product, exists := s.products.get(req.GetId())
+	if !exists {
+		return nil, notFound("product", req.GetId())
+	}
+	return toProductReply(&product), nil
+}
+
+func (s *ProductServer) CreateProduct(ctx context.Context, req *productpb.CreateProductRequest) (*productpb.CreateProductReply, error) {
+	product := catalog.Product{
+		SKU:   req.GetSku(),
+		Name:  req.GetName(),
+		Price: moneyFromProto(req.GetPrice()),
+		Stock: req.GetStock(),
+	}
+	if err := product.Validate(); err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	product.ID = s.ids.New(id.Product)
+	if err := s.products.create(product); err != nil {
+		return nil, err
+	}
+
+	return &productpb.CreateProductReply{
+		Id:     product.ID,
+		Status: &common.ResponseStatus{Code: 201, Message: "Product created successfully"},
+	}, nil
+}
+
+func (s *ProductServer) UpdateProduct(ctx context.Context, req *productpb.UpdateProductRequest) (*productpb.GetProductReply, error) {
+	if err := validateID("id", id.Product, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	// an empty mask means a full update
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"sku", "name", "price", "stock"}
+	}
+
+	updated, err := s.products.update(req.GetId(), func(updated catalog.Product) (catalog.Product, error) {
+		for _, path := range paths {
+			switch path {
+			case "sku":
+				updated.SKU = req.GetSku()
+			case "name":
+				updated.Name = req.GetName()
+			case "price":
+				updated.Price = moneyFromProto(req.GetPrice())
+			case "stock":
+				updated.Stock = req.GetStock()
+			default:
+				return updated, invalidField("update_mask.paths", fmt.Sprintf("unknown path %q, expected sku, name, price or stock", path))
+			}
+		}
+		if err := updated.Validate(); err != nil {
+			return updated, invalidRequest(err)
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toProductReply(&updated), nil
+}
+
+func (s *ProductServer) DeleteProduct(ctx context.Context, req *productpb.DeleteProductRequest) (*productpb.DeleteProductReply, error) {
+	if err := validateID("id", id.Product, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	// orders keep a priced copy of their line items, they aren't affected
+	if err := s.products.delete(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	return &productpb.DeleteProductReply{
+		Status: &common.ResponseStatus{Code: 200, Message: "Product deleted"},
+	}, nil
+}
+
+// ListProducts pages through the products ordered by id, like ListUsers.
+func (s *ProductServer) ListProducts(ctx context.Context, req *productpb.ListProductsRequest) (*productpb.ListProductsReply, error) {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, invalidField("page_size", "must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	after, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, invalidField("page_token", "not a token returned by ListProducts")
+	}
+
+	matches := s.products.list(after)
+	reply := &productpb.ListProductsReply{
+		Status: &common.ResponseStatus{Code: 200, Message: "OK"},
+	}
+	if len(matches) > pageSize {
+		matches = matches[:pageSize]
+		reply.NextPageToken = encodePageToken(matches[pageSize-1].ID)
+	}
+	for _, product := range matches {
+		reply.Products = append(reply.Products, toProductReply(&product))
+	}
+
+	return reply, nil
+}
+
+func toProductReply(product *catalog.Product) *productpb.GetProductReply {
+	return &productpb.GetProductReply{
+		Id:     product.ID,
+		Sku:    product.SKU,
+		Name:   product.Name,
+		Price:  moneyToProto(product.Price),
+		Stock:  product.Stock,
+		Status: &common.ResponseStatus{Code: 200, Message: "OK"},
+	}
+}
+
+func moneyFromProto(m *common.Money) money.Money {
+	return money.New(m.GetAmount(), m.GetCurrency())
+}
+
+func moneyToProto(m money.Money) *common.Money {
+	return &common.Money{Amount: m.Amount, Currency: m.Currency}
+}
@@ -0,0 +1,98 @@
+// Package services implements the gRPC services. They are served over the
+// network by cmd/grpc/server and in-process by the REST gateway.
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go-learning/internal/broadcast"
+	"go-learning/internal/idempotency"
+	"go-learning/internal/orders"
+	"go-learning/pkg/events"
+	orderpb "go-learning/pkg/grpc/order"
+	userpb "go-learning/pkg/grpc/user"
+	"go-learning/pkg/id"
+)
+
+// Option replaces a collaborator of a server, tests use them to get
+// reproducible replies.
+type Option func(*deps)
+
+type deps struct {
+	now func() time.Time
+	ids *id.Generator
+	bus *events.Bus
+}
+
+// WithClock makes a server read the time from now instead of time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(d *deps) { d.now = now }
+}
+
+// WithIDs makes a server take its ids from ids instead of id.Default.
+func WithIDs(ids *id.Generator) Option {
+	return func(d *deps) { d.ids = ids }
+}
+
+// WithEvents makes a server publish its domain events to bus. The order
+// server writes its events to the outbox instead, see internal/outbox.
+func WithEvents(bus *events.Bus) Option {
+	return func(d *deps) { d.bus = bus }
+}
+
+func newDeps(opts []Option) deps {
+	d := deps{now: time.Now, ids: id.Default}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	return d
+}
+
+// NewUserServer returns the UserService implementation over stores.Users.
+// Creations with a request_id are deduplicated for dedupWindow.
+func NewUserServer(stores *Stores, dedupWindow time.Duration, opts ...Option) *UserServer {
+	d := newDeps(opts)
+	return &UserServer{
+		users:   stores.Users,
+		ids:     d.ids,
+		bus:     d.bus,
+		created: idempotency.New[*userpb.CreateUserReply](dedupWindow, d.now),
+	}
+}
+
+// NewOrderServer returns the OrderService implementation over
+// stores.Orders, orders are priced with pricing. Creations with a
+// request_id are deduplicated for dedupWindow.
+func NewOrderServer(stores *Stores, pricing orders.Pricing, dedupWindow time.Duration, opts ...Option) *OrderServer {
+	d := newDeps(opts)
+	return &OrderServer{
+		orders:   stores.Orders,
+		users:    stores.Users,
+		products: stores.Products,
+		pricing:  pricing,
+		now:      d.now,
+		ids:      d.ids,
+		created:  idempotency.New[*orderpb.CreateOrderReply](dedupWindow, d.now),
+		events:   broadcast.New[orderEvent](watchHistory, watchBuffer),
+	}
+}
+
+// NewProductServer returns the ProductService implementation over
+// stores.Products.
+func NewProductServer(stores *Stores, opts ...Option) *ProductServer {
+	return &ProductServer{products: stores.Products, ids: newDeps(opts).ids}
+}
+
+// publishEvent hands e to the bus once the change is saved. The reply
+// doesn't depend on it, so a failure is only logged. The change is saved
+// whether or not the client is still waiting, so its event is published
+// even when the RPC is cancelled: only closing the bus stops it.
+func publishEvent(ctx context.Context, bus *events.Bus, e events.Event) {
+	ctx = context.WithoutCancel(ctx)
+	if err := bus.Publish(ctx, e); err != nil {
+		slog.WarnContext(ctx, "event not published",
+			slog.String("event_type", e.EventType()), slog.String("error", err.Error()))
+	}
+}
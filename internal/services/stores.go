@@ -0,0 +1,443 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go-learning/internal/catalog"
+	"go-learning/internal/orders"
+	"go-learning/internal/outbox"
+	userpb "go-learning/pkg/grpc/user"
+)
+
+// Stores holds the state of the services. Each service owns one store and
+// locks it on its own, so reading users never waits for an order being
+// written. The order service also looks up users and reserves products
+// through their stores.
+//
+// The stores live in memory. When opened with OpenStores every change is
+// also written to a journal on disk before it's applied, see journal.go.
+//
+// The events of the order changes are kept in the Outbox store, journaled
+// with the change itself, until a relay delivered them.
+type Stores struct {
+	Users    *UserStore
+	Orders   *OrderStore
+	Products *ProductStore
+	Outbox   *OutboxStore
+
+	journal *journal
+}
+
+// NewStores returns empty in-memory stores.
+func NewStores() *Stores {
+	products := &ProductStore{products: make(map[string]*catalog.Product)}
+	box := &OutboxStore{added: make(chan struct{}, 1)}
+	return &Stores{
+		Users:    &UserStore{users: make(map[string]*userpb.GetUserReply)},
+		Orders:   &OrderStore{orders: make(map[string]*orders.Order), products: products, outbox: box},
+		Products: products,
+		Outbox:   box,
+	}
+}
+
+// UserStore holds the users. The stored replies are never modified, an
+// update stores a new one, so they can be handed out without copying.
+type UserStore struct {
+	mu      sync.RWMutex
+	users   map[string]*userpb.GetUserReply
+	journal *journal
+}
+
+func (s *UserStore) get(userID string) (*userpb.GetUserReply, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, exists := s.users[userID]
+	return user, exists
+}
+
+func (s *UserStore) put(user *userpb.GetUserReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.journal.write(&change{Users: []journaledUser{{user}}}); err != nil {
+		return err
+	}
+	s.users[user.GetId()] = user
+	return nil
+}
+
+// update replaces a user with the one returned by apply.
+func (s *UserStore) update(userID string, apply func(*userpb.GetUserReply) (*userpb.GetUserReply, error)) (*userpb.GetUserReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, notFound("user", userID)
+	}
+	updated, err := apply(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.journal.write(&change{Users: []journaledUser{{updated}}}); err != nil {
+		return nil, err
+	}
+	s.users[userID] = updated
+	return updated, nil
+}
+
+func (s *UserStore) delete(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[userID]; !exists {
+		return notFound("user", userID)
+	}
+	if err := s.journal.write(&change{DeletedUsers: []string{userID}}); err != nil {
+		return err
+	}
+	delete(s.users, userID)
+	return nil
+}
+
+// list returns the users after the given id matching keep, ordered by id.
+func (s *UserStore) list(after string, keep func(*userpb.GetUserReply) bool) []*userpb.GetUserReply {
+	s.mu.RLock()
+	var matches []*userpb.GetUserReply
+	for _, user := range s.users {
+		if user.GetId() > after && keep(user) {
+			matches = append(matches, user)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b *userpb.GetUserReply) int { return strings.Compare(a.GetId(), b.GetId()) })
+	return matches
+}
+
+// ProductStore holds the catalog. Products are copied in and out, the
+// stock of a stored product only changes under the lock.
+type ProductStore struct {
+	mu       sync.RWMutex
+	products map[string]*catalog.Product
+	journal  *journal
+}
+
+// get is the orders.ProductLookup over the store.
+func (s *ProductStore) get(productID string) (catalog.Product, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookup(productID)
+}
+
+// lookup is get for callers holding s.mu.
+func (s *ProductStore) lookup(productID string) (catalog.Product, bool) {
+	product, exists := s.products[productID]
+	if !exists {
+		return catalog.Product{}, false
+	}
+	return *product, true
+}
+
+// create stores a new product, its sku must not be used yet.
+func (s *ProductStore) create(product catalog.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkSKUAvailable(product.SKU, ""); err != nil {
+		return err
+	}
+	if err := s.journal.write(&change{Products: []catalog.Product{product}}); err != nil {
+		return err
+	}
+	s.products[product.ID] = &product
+	return nil
+}
+
+// update replaces a product with the one returned by apply.
+func (s *ProductStore) update(productID string, apply func(catalog.Product) (catalog.Product, error)) (catalog.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, exists := s.products[productID]
+	if !exists {
+		return catalog.Product{}, notFound("product", productID)
+	}
+	updated, err := apply(*product)
+	if err != nil {
+		return catalog.Product{}, err
+	}
+	if err := s.checkSKUAvailable(updated.SKU, updated.ID); err != nil {
+		return catalog.Product{}, err
+	}
+	if err := s.journal.write(&change{Products: []catalog.Product{updated}}); err != nil {
+		return catalog.Product{}, err
+	}
+	s.products[productID] = &updated
+	return updated, nil
+}
+
+func (s *ProductStore) delete(productID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.products[productID]; !exists {
+		return notFound("product", productID)
+	}
+	if err := s.journal.write(&change{DeletedProducts: []string{productID}}); err != nil {
+		return err
+	}
+	delete(s.products, productID)
+	return nil
+}
+
+// list returns the products after the given id, ordered by id.
+func (s *ProductStore) list(after string) []catalog.Product {
+	s.mu.RLock()
+	var matches []catalog.Product
+	for _, product := range s.products {
+		if product.ID > after {
+			matches = append(matches, *product)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b catalog.Product) int { return strings.Compare(a.ID, b.ID) })
+	return matches
+}
+
+// restock returns the products of the items with their stock moved by
+// sign times the quantities, without storing them. The products deleted
+// since the order was placed are skipped. s.mu must be held.
+func (s *ProductStore) restock(items []orders.LineItem, sign int64) []catalog.Product {
+	var changed []catalog.Product
+	for _, line := range items {
+		if product, exists := s.products[line.ProductID]; exists {
+			product := *product
+			product.Stock += sign * line.Quantity
+			changed = append(changed, product)
+		}
+	}
+	return changed
+}
+
+// checkSKUAvailable makes sure no other product uses the sku, s.mu must be
+// held.
+func (s *ProductStore) checkSKUAvailable(sku, productID string) error {
+	for _, other := range s.products {
+		if other.SKU == sku && other.ID != productID {
+			return alreadyExists("product", other.ID, fmt.Sprintf("sku %q is already used by product %q", sku, other.ID))
+		}
+	}
+	return nil
+}
+
+// OrderStore holds the orders. Orders are replaced rather than modified,
+// so a change that fails to be journaled leaves the stored one untouched.
+//
+// Placing or cancelling an order also moves the stock of its products and
+// adds its event to the outbox, all journaled as one change. The product
+// lock is always taken after the order lock, and the outbox lock last.
+type OrderStore struct {
+	mu       sync.RWMutex
+	orders   map[string]*orders.Order
+	products *ProductStore
+	outbox   *OutboxStore
+	journal  *journal
+}
+
+// recordFunc returns the outbox record of an order change.
+type recordFunc func(*orders.Order) (outbox.Record, error)
+
+// view runs fn on an order under the read lock.
+func (s *OrderStore) view(orderID string, fn func(*orders.Order)) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	order, exists := s.orders[orderID]
+	if exists {
+		fn(order)
+	}
+	return exists
+}
+
+// create stores the order returned by build and takes its stock, build
+// prices it from the catalog under the same lock so two orders can't get
+// the last item. The record of the order is added to the outbox with it.
+// added runs under the lock, so whatever it publishes is ordered like the
+// changes.
+func (s *OrderStore) create(build func(orders.ProductLookup) (*orders.Order, error), record recordFunc, added func(*orders.Order)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, err := s.reserve(build, record)
+	if err != nil {
+		return err
+	}
+	s.orders[order.ID] = order
+	added(order)
+	return nil
+}
+
+func (s *OrderStore) reserve(build func(orders.ProductLookup) (*orders.Order, error), record recordFunc) (*orders.Order, error) {
+	s.products.mu.Lock()
+	defer s.products.mu.Unlock()
+
+	order, err := build(s.products.lookup)
+	if err != nil {
+		return nil, err
+	}
+	event, err := record(order)
+	if err != nil {
+		return nil, err
+	}
+	reserved := s.products.restock(order.Items, -1)
+	if err := s.outbox.write(&change{Orders: []*orders.Order{order}, Products: reserved}, &event); err != nil {
+		return nil, err
+	}
+	for _, product := range reserved {
+		s.products.products[product.ID] = &product
+	}
+	return order, nil
+}
+
+// update applies a change to a copy of an order and stores it. With
+// releaseStock, the stock of the order is given back. The record of the
+// change, if record isn't nil, is added to the outbox with it. changed runs
+// under the lock like in create.
+func (s *OrderStore) update(orderID string, releaseStock bool, apply func(*orders.Order) error, record recordFunc, changed func(*orders.Order)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, exists := s.orders[orderID]
+	if !exists {
+		return notFound("order", orderID)
+	}
+	updated := cloneOrder(order)
+	if err := apply(updated); err != nil {
+		return err
+	}
+	var event *outbox.Record
+	if record != nil {
+		r, err := record(updated)
+		if err != nil {
+			return err
+		}
+		event = &r
+	}
+
+	var released []catalog.Product
+	if releaseStock {
+		s.products.mu.Lock()
+		defer s.products.mu.Unlock()
+		released = s.products.restock(updated.Items, 1)
+	}
+	if err := s.outbox.write(&change{Orders: []*orders.Order{updated}, Products: released}, event); err != nil {
+		return err
+	}
+	for _, product := range released {
+		s.products.products[product.ID] = &product
+	}
+	s.orders[orderID] = updated
+	changed(updated)
+	return nil
+}
+
+// byUser runs fn on the orders of a user, ordered by id, under the read
+// lock.
+func (s *OrderStore) byUser(userID string, fn func(*orders.Order)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userOrders []*orders.Order
+	for _, order := range s.orders {
+		if order.UserID == userID {
+			userOrders = append(userOrders, order)
+		}
+	}
+	slices.SortFunc(userOrders, func(a, b *orders.Order) int { return strings.Compare(a.ID, b.ID) })
+	for _, order := range userOrders {
+		fn(order)
+	}
+}
+
+// cloneOrder copies an order deep enough for a transition to change the
+// copy only.
+func cloneOrder(order *orders.Order) *orders.Order {
+	clone := *order
+	clone.Items = slices.Clone(order.Items)
+	clone.History = slices.Clone(order.History)
+	return &clone
+}
+
+// OutboxStore holds the events of the order changes until they're
+// delivered, it is the outbox.Source of the relay. Records are added by the
+// order store, in the same journal change as the order.
+type OutboxStore struct {
+	mu      sync.Mutex
+	seq     uint64          // of the last record
+	pending []outbox.Record // by Seq
+	journal *journal
+	added   chan struct{}
+}
+
+// write journals c along with record, which gets the next sequence and is
+// pending once c is saved. A nil record only journals c. The caller holds
+// the locks of the other stores c touches.
+func (s *OutboxStore) write(c *change, record *outbox.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record == nil {
+		return s.journal.write(c)
+	}
+
+	record.Seq = s.seq + 1
+	c.Outbox = []outbox.Record{*record}
+	if err := s.journal.write(c); err != nil {
+		return err
+	}
+	s.seq = record.Seq
+	s.pending = append(s.pending, *record)
+	select {
+	case s.added <- struct{}{}:
+	default:
+		// the relay is already notified
+	}
+	return nil
+}
+
+func (s *OutboxStore) Pending(limit int) []outbox.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.pending[:min(limit, len(s.pending))])
+}
+
+func (s *OutboxStore) Stats() (int, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return 0, time.Time{}
+	}
+	return len(s.pending), s.pending[0].CreatedAt
+}
+
+// MarkDelivered journals the delivery of the records and drops them.
+func (s *OutboxStore) MarkDelivered(seqs []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.journal.write(&change{Delivered: seqs}); err != nil {
+		return err
+	}
+	s.drop(seqs)
+	return nil
+}
+
+func (s *OutboxStore) Added() <-chan struct{} {
+	return s.added
+}
+
+// drop removes the records with the given sequences, s.mu must be held.
+func (s *OutboxStore) drop(seqs []uint64) {
+	s.pending = slices.DeleteFunc(s.pending, func(r outbox.Record) bool {
+		return slices.Contains(seqs, r.Seq)
+	})
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go-learning/internal/orders"
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestConcurrentServices runs every service at once over shared stores,
+// it's meant to run with -race. The stock taken by the orders left must
+// add up with what remains in the catalog.
+func TestConcurrentServices(t *testing.T) {
+	ctx := context.Background()
+	stores := NewStores()
+	users := NewUserServer(stores, 0)
+	products := NewProductServer(stores)
+	s := NewOrderServer(stores, orders.Pricing{}, 0)
+	defer s.Close()
+
+	const stock = 50
+	product, err := products.CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "RACE-001", Name: "Race", Price: &common.Money{Amount: 100, Currency: "USD"}, Stock: stock,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	user, _ := users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Racer", Email: "racer@example.com"})
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				created, err := s.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+					UserId: user.GetId(),
+					Items:  []*orderpb.OrderItem{{ProductId: product.GetId(), Quantity: 1}},
+				})
+				if status.Code(err) == codes.FailedPrecondition {
+					continue // out of stock, another goroutine got the last one
+				}
+				if err != nil {
+					t.Errorf("Expected no error, but got %v", err)
+					return
+				}
+				if j%2 == 0 {
+					if _, err := s.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: created.GetId()}); err != nil {
+						t.Errorf("Expected no error, but got %v", err)
+					}
+				}
+				users.UpdateUser(ctx, &userpb.UpdateUserRequest{Id: user.GetId(), Name: fmt.Sprintf("Racer %d", i), Email: "racer@example.com"})
+				users.ListUsers(ctx, &userpb.ListUsersRequest{})
+				products.ListProducts(ctx, &productpb.ListProductsRequest{})
+				s.ListOrdersByUser(ctx, &orderpb.ListOrdersByUserRequest{UserId: user.GetId()})
+			}
+		}()
+	}
+	wg.Wait()
+
+	list, err := s.ListOrdersByUser(ctx, &orderpb.ListOrdersByUserRequest{UserId: user.GetId()})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	var reserved int64
+	for _, order := range list.GetOrders() {
+		if order.GetState() != orderpb.OrderState_ORDER_STATE_CANCELLED {
+			reserved += order.GetItems()[0].GetQuantity()
+		}
+	}
+	left, _ := products.GetProduct(ctx, &productpb.GetProductRequest{Id: product.GetId()})
+	if left.GetStock()+reserved != stock {
+		t.Errorf("Expected %d items in stock or reserved, but got %d left and %d reserved", stock, left.GetStock(), reserved)
+	}
+	if left.GetStock() < 0 {
+		t.Errorf("Expected the stock to never go negative, but got %d", left.GetStock())
+	}
+}
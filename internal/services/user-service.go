@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"go-learning/internal/idempotency"
+	"go-learning/pkg/events"
+	common "go-learning/pkg/grpc/common"
+	userpb "go-learning/pkg/grpc/user"
+	"go-learning/pkg/id"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type UserServer struct {
+	userpb.UnimplementedUserServiceServer
+	users   *UserStore
+	ids     *id.Generator
+	bus     *events.Bus
+	created *idempotency.Store[*userpb.CreateUserReply]
+}
+
+func (s *UserServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.GetUserReply, error) {
+	if err := validateID("id", id.User, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	user, exists := s.users.get(req.GetId())
+	if !exists {
+		return nil, notFound("user", req.GetId())
+	}
+	return user, nil
+}
+
+// CreateUser creates a user, once per request_id: a retry gets the reply
+// of the first request.
+func (s *UserServer) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.CreateUserReply, error) {
+	return dedup(ctx, s.created, req.GetRequestId(), req, func() (*userpb.CreateUserReply, error) {
+		return s.createUser(ctx, req)
+	})
+}
+
+func (s *UserServer) createUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.CreateUserReply, error) {
+	userID := s.ids.New(id.User)
+	user := &userpb.GetUserReply{
+		Id:    userID,
+		Name:  req.GetName(),
+		Email: req.GetEmail(),
+		Status: &common.ResponseStatus{
+			Code:    201,
+			Message: "User created",
+		},
+	}
+	if err := s.users.put(user); err != nil {
+		return nil, err
+	}
+	publishEvent(ctx, s.bus, events.UserCreated{UserID: userID, Name: user.GetName(), Email: user.GetEmail()})
+
+	return &userpb.CreateUserReply{
+		Id:     userID,
+		Status: &common.ResponseStatus{Code: 201, Message: "User created successfully"},
+	}, nil
+}
+
+func (s *UserServer) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest) (*userpb.GetUserReply, error) {
+	if err := validateID("id", id.User, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	// an empty mask means a full update
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"name", "email"}
+	}
+	for _, path := range paths {
+		if path != "name" && path != "email" {
+			return nil, invalidField("update_mask.paths", fmt.Sprintf("unknown path %q, expected name or email", path))
+		}
+	}
+
+	return s.users.update(req.GetId(), func(user *userpb.GetUserReply) (*userpb.GetUserReply, error) {
+		// update a copy so a reply already handed out never changes under the caller
+		updated := &userpb.GetUserReply{
+			Id:     user.GetId(),
+			Name:   user.GetName(),
+			Email:  user.GetEmail(),
+			Status: &common.ResponseStatus{Code: 200, Message: "User updated"},
+		}
+		for _, path := range paths {
+			switch path {
+			case "name":
+				updated.Name = req.GetName()
+			case "email":
+				updated.Email = req.GetEmail()
+			}
+		}
+		return updated, nil
+	})
+}
+
+func (s *UserServer) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*userpb.DeleteUserReply, error) {
+	if err := validateID("id", id.User, req.GetId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.delete(req.GetId()); err != nil {
+		return nil, err
+	}
+
+	return &userpb.DeleteUserReply{
+		Status: &common.ResponseStatus{Code: 200, Message: "User deleted"},
+	}, nil
+}
+
+// ListUsers pages through the users ordered by id, that is by creation
+// time. The page token is the last id of the previous page, so pages stay
+// stable when users are created or deleted in between calls.
+func (s *UserServer) ListUsers(ctx context.Context, req *userpb.ListUsersRequest) (*userpb.ListUsersReply, error) {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, invalidField("page_size", "must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	after, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, invalidField("page_token", "not a token returned by ListUsers")
+	}
+
+	nameFilter := strings.ToLower(req.GetNameContains())
+	emailFilter := strings.ToLower(req.GetEmailContains())
+
+	matches := s.users.list(after, func(user *userpb.GetUserReply) bool {
+		return strings.Contains(strings.ToLower(user.GetName()), nameFilter) &&
+			strings.Contains(strings.ToLower(user.GetEmail()), emailFilter)
+	})
+
+	reply := &userpb.ListUsersReply{
+		Status: &common.ResponseStatus{Code: 200, Message: "OK"},
+	}
+	if len(matches) > pageSize {
+		matches = matches[:pageSize]
+		reply.NextPageToken = encodePageToken(matches[pageSize-1].GetId())
+	}
+	reply.Users = matches
+
+	return reply, nil
+}
+
+// Page tokens are opaque to clients, they must not rely on them being ids.
+func encodePageToken(lastID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastID))
+}
+
+func decodePageToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	return string(b), err
+}
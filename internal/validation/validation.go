@@ -0,0 +1,35 @@
+package validation
+
+import "errors"
+
+// FieldError is a validation error on a single request field, so the APIs
+// can tell clients exactly which field to fix.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string { return e.Field + ": " + e.Err.Error() }
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Field returns a FieldError for the given field.
+func Field(field string, err error) *FieldError {
+	return &FieldError{Field: field, Err: err}
+}
+
+// FieldErrors returns every FieldError in err, following errors.Join.
+func FieldErrors(err error) []*FieldError {
+	var fieldErrs []*FieldError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			fieldErrs = append(fieldErrs, FieldErrors(e)...)
+		}
+		return fieldErrs
+	}
+
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		fieldErrs = append(fieldErrs, fieldErr)
+	}
+	return fieldErrs
+}
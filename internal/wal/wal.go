@@ -0,0 +1,532 @@
+// Package wal is a write-ahead log: records are appended to segment files
+// with a checksum, and a snapshot of the state they build lets the older
+// segments be deleted. Opening a log replays the snapshot and the records
+// written after it, a record torn by a crash at the end of the log is cut
+// off. A bad record followed by valid ones wasn't torn by a crash, opening
+// the log fails with ErrCorrupt rather than dropping them.
+//
+// A directory holds:
+//
+//	snapshot              the state up to a segment, replaced atomically
+//	00000000000000000001.wal
+//	00000000000000000002.wal  segments, replayed in order after the snapshot
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCorrupt means a record failed its checksum before the end of the
+	// log, so it wasn't torn by a crash and can't be skipped.
+	ErrCorrupt = errors.New("wal: corrupt record")
+	// ErrClosed is returned by the operations on a closed log.
+	ErrClosed = errors.New("wal: closed")
+	// ErrSyncFailed is returned by every write once an fsync failed. The
+	// kernel may have dropped the unsynced pages and a retry can't tell, so
+	// the log must be reopened to know what's on disk.
+	ErrSyncFailed = errors.New("wal: fsync failed, the log must be reopened")
+
+	// errTorn is a record cut short by the end of the segment.
+	errTorn = errors.New("torn record")
+)
+
+// SyncPolicy tells when appended records are flushed to disk with fsync.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs every record before Append returns, nothing
+	// acknowledged is lost.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs in the background every Options.SyncInterval, a
+	// crash loses at most that much.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system, the records
+	// survive a crash of the process but not of the machine.
+	SyncNever SyncPolicy = "never"
+)
+
+// ParseSyncPolicy parses "always", "interval" or "never".
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(s); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("wal: unknown sync policy %q, expected always, interval or never", s)
+}
+
+// Options configures a log, the zero value syncs every record.
+type Options struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // 100ms when 0
+}
+
+const (
+	headerSize = 8 // record length and checksum, both uint32 little endian
+	// maxRecordSize rejects the garbage length of a torn header before
+	// trying to allocate it.
+	maxRecordSize = 64 << 20
+	// scanBudget bounds the bytes findRecord checksums, per byte it scans.
+	scanBudget = 64
+
+	snapshotName  = "snapshot"
+	segmentSuffix = ".wal"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Log appends records to the current segment. It is safe for concurrent
+// use.
+type Log struct {
+	dir  string
+	opts Options
+
+	mu      sync.Mutex
+	f       *os.File
+	segment uint64
+	size    int64 // of the current segment, up to the last complete record
+	dirty   bool  // records were written since the last fsync
+	closed  bool
+	failed  error // of the fsync that failed, every write then fails
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open recovers the log in dir, creating it if needed. restore gets the
+// last snapshot, if any, then apply gets every record written after it in
+// order. A torn record at the end of the last segment is truncated, so the
+// log can be appended to again.
+func Open(dir string, opts Options, restore func(snapshot []byte) error, apply func(record []byte) error) (*Log, error) {
+	if opts.Sync == "" {
+		opts.Sync = SyncAlways
+	}
+	if _, err := ParseSyncPolicy(string(opts.Sync)); err != nil {
+		return nil, err
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = 100 * time.Millisecond
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, opts: opts, stop: make(chan struct{}), done: make(chan struct{})}
+
+	first, err := l.restore(restore)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if segment < first {
+			// already in the snapshot, a crash happened before it was removed
+			if err := os.Remove(l.segmentPath(segment)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	segments = slices.DeleteFunc(segments, func(s uint64) bool { return s < first })
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if err := l.replay(segment, last, apply); err != nil {
+			return nil, err
+		}
+	}
+
+	next := first
+	if len(segments) > 0 {
+		next = segments[len(segments)-1]
+	}
+	if err := l.openSegment(next); err != nil {
+		return nil, err
+	}
+
+	if opts.Sync == SyncInterval {
+		go l.syncLoop()
+	} else {
+		close(l.done)
+	}
+	return l, nil
+}
+
+// Append writes a record and, with SyncAlways, flushes it to disk.
+func (l *Log) Append(record []byte) error {
+	if len(record) > maxRecordSize {
+		return fmt.Errorf("wal: record of %d bytes is over the %d bytes limit", len(record), maxRecordSize)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.usable(); err != nil {
+		return err
+	}
+
+	// a single write, so the record is either complete or torn at the end
+	if _, err := l.f.Write(frame(record)); err != nil {
+		// cut the partial record, the next ones would land after it and be
+		// lost with it when the log is replayed
+		l.f.Truncate(l.size)
+		return err
+	}
+	previous := l.size
+	l.size += headerSize + int64(len(record))
+	l.dirty = true
+
+	if l.opts.Sync == SyncAlways {
+		if err := l.sync(); err != nil {
+			// the caller is told the record failed, it must not be
+			// replayed; the records before it were synced already
+			if l.f.Truncate(previous) == nil {
+				l.size = previous
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync flushes the records appended so far to disk.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.usable(); err != nil {
+		return err
+	}
+	return l.sync()
+}
+
+// Rotate starts a new segment and returns its number. The caller snapshots
+// the state as of the rotation, no record may be appended in between, and
+// hands the snapshot to WriteSnapshot with that number.
+func (l *Log) Rotate() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.usable(); err != nil {
+		return 0, err
+	}
+
+	// the old segment must be complete on disk before records go elsewhere
+	if err := l.sync(); err != nil {
+		return 0, err
+	}
+	if err := l.f.Close(); err != nil {
+		return 0, err
+	}
+	if err := l.openSegment(l.segment + 1); err != nil {
+		return 0, err
+	}
+	return l.segment, nil
+}
+
+// WriteSnapshot atomically replaces the snapshot with state, which holds
+// everything written before segment next, then deletes those segments.
+func (l *Log) WriteSnapshot(state []byte, next uint64) error {
+	tmp := filepath.Join(l.dir, snapshotName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	// the snapshot is a single record starting with the segment number
+	payload := binary.LittleEndian.AppendUint64(make([]byte, 0, 8+len(state)), next)
+	payload = append(payload, state...)
+
+	_, err = f.Write(frame(payload))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(l.dir, snapshotName))
+	}
+	if err == nil {
+		err = syncDir(l.dir)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment < next {
+			if err := os.Remove(l.segmentPath(segment)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close flushes the log to disk and closes it.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.stop)
+	err := l.failed
+	if err == nil {
+		err = l.sync()
+	}
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.mu.Unlock()
+
+	<-l.done
+	return err
+}
+
+// usable returns why the log can't be written anymore, l.mu must be held.
+func (l *Log) usable() error {
+	if l.closed {
+		return ErrClosed
+	}
+	return l.failed
+}
+
+// sync fsyncs the current segment if needed, l.mu must be held. A failure
+// is final, see ErrSyncFailed.
+func (l *Log) sync() error {
+	if !l.dirty {
+		return nil
+	}
+	if err := l.f.Sync(); err != nil {
+		l.failed = fmt.Errorf("%w: %v", ErrSyncFailed, err)
+		return l.failed
+	}
+	l.dirty = false
+	return nil
+}
+
+func (l *Log) syncLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			// a failure makes the next writes fail, and Close reports it
+			l.Sync()
+		}
+	}
+}
+
+// restore hands the snapshot to fn and returns the first segment written
+// after it.
+func (l *Log) restore(fn func([]byte) error) (uint64, error) {
+	f, err := os.Open(filepath.Join(l.dir, snapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// the snapshot is renamed into place once complete, so unlike a
+	// segment it is never torn
+	payload, err := readRecord(bufio.NewReader(f))
+	if err != nil {
+		return 0, fmt.Errorf("%w: snapshot: %v", ErrCorrupt, err)
+	}
+	if len(payload) < 8 {
+		return 0, fmt.Errorf("%w: snapshot too short", ErrCorrupt)
+	}
+	if err := fn(payload[8:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(payload[:8]), nil
+}
+
+// replay applies the records of a segment. The last segment may end with
+// a torn record, it's truncated away; anywhere else, or with a valid
+// record after it, that's corruption.
+func (l *Log) replay(segment uint64, last bool, apply func([]byte) error) error {
+	f, err := os.OpenFile(l.segmentPath(segment), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		record, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("%w: segment %d at offset %d: %v", ErrCorrupt, segment, good, err)
+			}
+			// it's only the torn end of the log if nothing valid was
+			// written after it: a corrupt length looks torn too
+			after, found, scanErr := findRecord(f, good+1)
+			if scanErr != nil {
+				return fmt.Errorf("segment %d at offset %d: %w", segment, good, scanErr)
+			}
+			if found {
+				return fmt.Errorf("%w: segment %d at offset %d: %v, valid record at offset %d", ErrCorrupt, segment, good, err, after)
+			}
+			if err := f.Truncate(good); err != nil {
+				return err
+			}
+			return f.Sync()
+		}
+		if err := apply(record); err != nil {
+			return fmt.Errorf("wal: applying the record of segment %d at offset %d: %w", segment, good, err)
+		}
+		good += headerSize + int64(len(record))
+	}
+}
+
+// frame prepends the header to a record.
+func frame(record []byte) []byte {
+	b := make([]byte, headerSize, headerSize+len(record))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(record)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.Checksum(record, crcTable))
+	return append(b, record...)
+}
+
+// readRecord reads one record, io.EOF means the log ends cleanly before it
+// and errTorn that it ends in the middle of it.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: header", errTorn)
+		}
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("record length %d over the limit", size)
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, errTorn
+	}
+	if crc32.Checksum(record, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return record, nil
+}
+
+// findRecord looks for a valid record starting anywhere from offset on,
+// and returns where. Empty records aren't looked for, the zeros a crash may
+// leave at the end of a file would pass for them.
+//
+// Only the candidates that could be followed by what's after them, the end
+// of the file or a header with a possible length, are checksummed, and at
+// most scanBudget bytes per byte scanned: past that, the log is reported
+// corrupt rather than scanned any longer.
+func findRecord(f *os.File, offset int64) (int64, bool, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, false, err
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		return 0, false, err
+	}
+	budget := scanBudget * len(rest)
+	for i := 0; i+headerSize < len(rest); i++ {
+		size := int(binary.LittleEndian.Uint32(rest[i : i+4]))
+		if size == 0 || size > len(rest)-i-headerSize {
+			continue
+		}
+		end := i + headerSize + size
+		if len(rest)-end >= headerSize && binary.LittleEndian.Uint32(rest[end:end+4]) > maxRecordSize {
+			continue
+		}
+		if budget -= size; budget < 0 {
+			return 0, false, fmt.Errorf("%w: no end found to the bad records after offset %d", ErrCorrupt, offset)
+		}
+		record := rest[i+headerSize : end]
+		if crc32.Checksum(record, crcTable) == binary.LittleEndian.Uint32(rest[i+4:i+8]) {
+			return offset + int64(i), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// openSegment opens a segment for appending, creating it if needed.
+func (l *Log) openSegment(segment uint64) error {
+	f, err := os.OpenFile(l.segmentPath(segment), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		err = syncDir(l.dir)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.segment, l.size = f, segment, info.Size()
+	return nil
+}
+
+// segments lists the segment numbers in dir, in order.
+func (l *Log) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentSuffix)
+		if !ok {
+			continue
+		}
+		segment, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+func (l *Log) segmentPath(segment uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", segment, segmentSuffix))
+}
+
+// syncDir makes the creation, removal or renaming of files in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
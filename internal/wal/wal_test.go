@@ -0,0 +1,298 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// opened is a log and what it replayed when opened.
+type opened struct {
+	log      *Log
+	snapshot string
+	records  []string
+}
+
+func open(t *testing.T, dir string, opts Options) *opened {
+	t.Helper()
+	o := &opened{}
+	l, err := Open(dir, opts,
+		func(snapshot []byte) error { o.snapshot = string(snapshot); return nil },
+		func(record []byte) error { o.records = append(o.records, string(record)); return nil },
+	)
+	if err != nil {
+		t.Fatalf("Expected the log to open, but got %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	o.log = l
+	return o
+}
+
+func appendAll(t *testing.T, l *Log, records ...string) {
+	t.Helper()
+	for _, r := range records {
+		if err := l.Append([]byte(r)); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func TestReplay(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(string(policy), func(t *testing.T) {
+			dir := t.TempDir()
+			first := open(t, dir, Options{Sync: policy})
+			appendAll(t, first.log, "a", "b", "", "c")
+			first.log.Close()
+
+			second := open(t, dir, Options{Sync: policy})
+			if want := []string{"a", "b", "", "c"}; !equal(second.records, want) {
+				t.Errorf("Expected %q, but got %q", want, second.records)
+			}
+		})
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	first := open(t, dir, Options{})
+	appendAll(t, first.log, "a", "b", "c")
+	first.log.Close()
+
+	segment := filepath.Join(dir, fmt.Sprintf("%020d.wal", 1))
+	complete, _ := os.ReadFile(segment)
+
+	for _, tc := range []struct {
+		name string
+		tail []byte
+	}{
+		{"torn header", []byte{5, 0}},
+		{"torn record", frame([]byte("hello"))[:headerSize+2]},
+		{"bad checksum", append(frame([]byte("hello"))[:headerSize], "HELLO"...)},
+		{"garbage length", bytes.Repeat([]byte{0xff}, 16)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.WriteFile(segment, append(bytes.Clone(complete), tc.tail...), 0o644)
+
+			reopened := open(t, dir, Options{})
+			if want := []string{"a", "b", "c"}; !equal(reopened.records, want) {
+				t.Errorf("Expected %q, but got %q", want, reopened.records)
+			}
+			if info, _ := os.Stat(segment); info.Size() != int64(len(complete)) {
+				t.Errorf("Expected the tail to be truncated to %d bytes, but got %d", len(complete), info.Size())
+			}
+
+			// appending after the recovery doesn't lose anything
+			appendAll(t, reopened.log, "d")
+			reopened.log.Close()
+			again := open(t, dir, Options{})
+			if !equal(again.records, []string{"a", "b", "c", "d"}) {
+				t.Errorf("Expected the new record after the old ones, but got %q", again.records)
+			}
+			again.log.Close()
+			os.WriteFile(segment, complete, 0o644)
+		})
+	}
+}
+
+func TestCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	first := open(t, dir, Options{})
+	appendAll(t, first.log, "a", "b")
+	first.log.Rotate()
+	appendAll(t, first.log, "c")
+	first.log.Close()
+
+	// the damage isn't at the end of the log, it can't be a crash
+	segment := filepath.Join(dir, fmt.Sprintf("%020d.wal", 1))
+	b, _ := os.ReadFile(segment)
+	b[headerSize] ^= 0xff
+	os.WriteFile(segment, b, 0o644)
+
+	_, err := Open(dir, Options{}, func([]byte) error { return nil }, func([]byte) error { return nil })
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, but got %v", err)
+	}
+}
+
+// TestCorruptLastSegment damages a record of the last segment that has
+// valid ones after it: they were acknowledged, cutting them would lose them.
+func TestCorruptLastSegment(t *testing.T) {
+	dir := t.TempDir()
+	first := open(t, dir, Options{})
+	appendAll(t, first.log, "a", "b", "c")
+	first.log.Close()
+
+	segment := filepath.Join(dir, fmt.Sprintf("%020d.wal", 1))
+	complete, _ := os.ReadFile(segment)
+	b := headerSize + 1 // where the frame of "b" starts
+
+	for _, tc := range []struct {
+		name   string
+		damage func([]byte)
+	}{
+		{"payload", func(seg []byte) { seg[b+headerSize] ^= 0xff }},
+		// a length past the end of the file reads like a torn record
+		{"length", func(seg []byte) { seg[b+1] = 0x10 }},
+		{"checksum", func(seg []byte) { seg[b+4] ^= 0xff }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			damaged := bytes.Clone(complete)
+			tc.damage(damaged)
+			os.WriteFile(segment, damaged, 0o644)
+
+			_, err := Open(dir, Options{}, func([]byte) error { return nil }, func([]byte) error { return nil })
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Expected ErrCorrupt, but got %v", err)
+			}
+			if info, _ := os.Stat(segment); info.Size() != int64(len(damaged)) {
+				t.Errorf("Expected the segment to be left as is, but got %d bytes instead of %d", info.Size(), len(damaged))
+			}
+		})
+	}
+}
+
+// TestFindRecordBudget scans a tail made of frames that all look possible
+// but none valid: the scan gives up instead of checksumming them all.
+func TestFindRecordBudget(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "segment"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer f.Close()
+
+	// at every offset, a length reaching the end of the file
+	const size = 1 << 16
+	tail := make([]byte, size)
+	for i := 0; i+4 <= size; i += 4 {
+		binary.LittleEndian.PutUint32(tail[i:], uint32(size-i-headerSize))
+	}
+	f.Write(tail)
+
+	if _, _, err := findRecord(f, 0); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, but got %v", err)
+	}
+}
+
+func TestSyncFailure(t *testing.T) {
+	o := open(t, t.TempDir(), Options{})
+	appendAll(t, o.log, "a")
+
+	// a pipe takes the write but can't be fsynced
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer r.Close()
+	o.log.mu.Lock()
+	segment := o.log.f
+	o.log.f = w
+	o.log.mu.Unlock()
+	defer segment.Close()
+
+	if err := o.log.Append([]byte("b")); !errors.Is(err, ErrSyncFailed) {
+		t.Errorf("Expected ErrSyncFailed, but got %v", err)
+	}
+	// nothing tells what the kernel kept, the log stays unusable
+	if err := o.log.Append([]byte("c")); !errors.Is(err, ErrSyncFailed) {
+		t.Errorf("Expected the next append to fail too, but got %v", err)
+	}
+	if _, err := o.log.Rotate(); !errors.Is(err, ErrSyncFailed) {
+		t.Errorf("Expected the rotation to fail, but got %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	first := open(t, dir, Options{})
+	appendAll(t, first.log, "a", "b")
+	next, err := first.log.Rotate()
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	appendAll(t, first.log, "c")
+	if err := first.log.WriteSnapshot([]byte("a+b"), next); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	appendAll(t, first.log, "d")
+	first.log.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%020d.wal", 1))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the compacted segment to be removed, but got %v", err)
+	}
+
+	second := open(t, dir, Options{})
+	if second.snapshot != "a+b" || !equal(second.records, []string{"c", "d"}) {
+		t.Errorf("Expected snapshot a+b then [c d], but got %q then %q", second.snapshot, second.records)
+	}
+}
+
+// TestKill kills a process appending to the log and checks that every
+// record it saw acknowledged is recovered, in order and without gaps.
+func TestKill(t *testing.T) {
+	if dir := os.Getenv("WAL_TEST_WRITER_DIR"); dir != "" {
+		writer(dir)
+		return
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestKill$")
+	cmd.Env = append(os.Environ(), "WAL_TEST_WRITER_DIR="+dir)
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Expected the writer to start, but got %v", err)
+	}
+
+	acked := -1
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() && acked < 300 {
+		acked, _ = strconv.Atoi(scanner.Text())
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	recovered := open(t, dir, Options{})
+	if len(recovered.records) <= acked {
+		t.Fatalf("Expected at least %d records, but got %d", acked+1, len(recovered.records))
+	}
+	for i, record := range recovered.records {
+		if n, _ := strconv.Atoi(record[:8]); n != i || len(record) != recordSize(i) {
+			t.Fatalf("Expected record %d, but got %q... of %d bytes", i, record[:8], len(record))
+		}
+	}
+}
+
+// recordSize varies so the kill may land in the middle of a large write.
+func recordSize(i int) int {
+	return 8 + (i*7919)%(256<<10)
+}
+
+// writer appends numbered records until it's killed, printing each one
+// once acknowledged.
+func writer(dir string) {
+	l, err := Open(dir, Options{Sync: SyncAlways}, func([]byte) error { return nil }, func([]byte) error { return nil })
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for i := 0; ; i++ {
+		record := bytes.Repeat([]byte{'x'}, recordSize(i))
+		copy(record, fmt.Sprintf("%08d", i))
+		if err := l.Append(record); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(i)
+	}
+}
@@ -1,7 +1,122 @@
 package auth
 
-import "fmt"
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
-func GenerateJWT() {
-	fmt.Println("Generating JWT...")
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+)
+
+// header is the only JOSE header produced and accepted, tokens are signed
+// with a shared secret using HMAC-SHA256.
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are the registered JWT claims used by the services.
+type Claims struct {
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// GenerateJWT signs a token for subject that expires after ttl.
+func GenerateJWT(secret []byte, subject string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return Sign(secret, Claims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+}
+
+// Sign encodes and signs the claims as an HS256 JWT.
+func Sign(secret []byte, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(secret, unsigned), nil
+}
+
+// Verify checks the signature and the validity window of an HS256 JWT and
+// returns its claims. A token without exp never expires.
+func Verify(secret []byte, token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformedToken
+	}
+
+	var head struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return Claims{}, err
+	}
+	// checking alg first rejects "none" and algorithm confusion attacks
+	if head.Alg != "HS256" {
+		return Claims{}, fmt.Errorf("%w: %q", ErrUnsupportedAlg, head.Alg)
+	}
+
+	want := signature(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(want)) {
+		return Claims{}, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+	if claims.ExpiresAt != 0 && now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return Claims{}, ErrTokenNotYetValid
+	}
+	return claims, nil
+}
+
+func signature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	return nil
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of the caller.
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims of an authenticated caller.
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
 }
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var secret = []byte("test-secret")
+
+func TestSignVerify(t *testing.T) {
+	token, err := GenerateJWT(secret, "u1", time.Minute)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	claims, err := Verify(secret, token, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if claims.Subject != "u1" {
+		t.Errorf("Expected subject u1, but got %q", claims.Subject)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	now := time.Now()
+	valid, _ := Sign(secret, Claims{Subject: "u1", ExpiresAt: now.Add(time.Minute).Unix()})
+	expired, _ := Sign(secret, Claims{Subject: "u1", ExpiresAt: now.Add(-time.Minute).Unix()})
+	early, _ := Sign(secret, Claims{Subject: "u1", NotBefore: now.Add(time.Minute).Unix()})
+	parts := strings.Split(valid, ".")
+	// {"alg":"none"}
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		want   error
+	}{
+		{"wrong secret", []byte("other"), valid, ErrInvalidSignature},
+		{"tampered payload", secret, parts[0] + "." + parts[1] + "x." + parts[2], ErrInvalidSignature},
+		{"alg none", secret, unsigned, ErrUnsupportedAlg},
+		{"expired", secret, expired, ErrTokenExpired},
+		{"not yet valid", secret, early, ErrTokenNotYetValid},
+		{"malformed", secret, "not-a-token", ErrMalformedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(tt.secret, tt.token, now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, but got %v", tt.want, err)
+			}
+		})
+	}
+}
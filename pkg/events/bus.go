@@ -0,0 +1,295 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-learning/pkg/id"
+)
+
+// ErrClosed is returned by a closed bus.
+var ErrClosed = errors.New("event bus closed")
+
+// Options configures a bus, the zero value is ready to use.
+type Options struct {
+	// Now stamps the deliveries, time.Now by default.
+	Now func() time.Time
+	// IDs generates the delivery ids, id.Default by default.
+	IDs *id.Generator
+}
+
+// Delivery is an event handed to a subscriber. Retries of the same event
+// have the same id, subscribers use it to ignore duplicates.
+type Delivery[E Event] struct {
+	ID string
+	At time.Time // when it was published
+	// Attempt is 1 on the first delivery and grows with every retry.
+	Attempt int
+	Event   E
+}
+
+// Handler handles the events of a subscription. It's retried while it
+// returns an error, ctx is cancelled when the bus stops waiting for it.
+type Handler[E Event] func(ctx context.Context, d Delivery[E]) error
+
+// SubscribeOptions configures a subscription, the zero value gives the
+// defaults.
+type SubscribeOptions struct {
+	// Buffer is how many events can wait for the subscriber, publishers
+	// block while it's full. 256 by default.
+	Buffer int
+	// MaxAttempts drops an event after that many failed attempts, 0 retries
+	// until the handler succeeds.
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry, doubled after every
+	// failure up to MaxBackoff. 100ms and 30s by default.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (o SubscribeOptions) withDefaults() SubscribeOptions {
+	if o.Buffer <= 0 {
+		o.Buffer = 256
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	o.MaxBackoff = max(o.MaxBackoff, o.MinBackoff)
+	return o
+}
+
+// Bus delivers the published events to the subscribers, each one in its
+// own goroutine and in the order they were published. It is safe for
+// concurrent use, and a nil *Bus drops everything.
+type Bus struct {
+	now func() time.Time
+	ids *id.Generator
+
+	mu     sync.RWMutex
+	subs   []*subscriber
+	closed bool
+
+	quit      chan struct{} // closed first, so blocked publishers give up
+	closeOnce sync.Once
+	ctx       context.Context // of the handlers
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup // the delivery goroutines
+}
+
+type subscriber struct {
+	name   string
+	opts   SubscribeOptions
+	match  func(Event) bool
+	handle Handler[Event]
+	queue  chan Delivery[Event]
+}
+
+// New returns a bus without subscribers. Close must be called to stop the
+// deliveries.
+func New(opts Options) *Bus {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.IDs == nil {
+		opts.IDs = id.Default
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bus{
+		now:    opts.Now,
+		ids:    opts.IDs,
+		quit:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Subscribe calls handle with every event of type E published from now
+// on, Subscribe[Event] gets all of them. The name identifies the
+// subscriber in the logs.
+func Subscribe[E Event](b *Bus, name string, handle Handler[E], opts SubscribeOptions) error {
+	if b == nil {
+		return nil
+	}
+	match := func(e Event) bool {
+		_, ok := e.(E)
+		return ok
+	}
+	return b.subscribe(name, match, func(ctx context.Context, d Delivery[Event]) error {
+		return handle(ctx, Delivery[E]{ID: d.ID, At: d.At, Attempt: d.Attempt, Event: d.Event.(E)})
+	}, opts)
+}
+
+func (b *Bus) subscribe(name string, match func(Event) bool, handle Handler[Event], opts SubscribeOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+
+	opts = opts.withDefaults()
+	sub := &subscriber{
+		name:   name,
+		opts:   opts,
+		match:  match,
+		handle: handle,
+		queue:  make(chan Delivery[Event], opts.Buffer),
+	}
+	b.subs = append(b.subs, sub)
+	b.wg.Add(1)
+	go b.deliver(sub)
+	return nil
+}
+
+// Publish queues e for every subscriber to it. It blocks while the buffer
+// of one of them is full, until ctx is done: the subscribers queued so far
+// still get the event and the error tells which one didn't.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	if b == nil {
+		return nil
+	}
+	return b.PublishWithID(ctx, b.ids.New(id.Event), e)
+}
+
+// PublishWithID is Publish for an event that already has an id, e.g. one
+// relayed from an outbox, so that publishing it again keeps the id the
+// subscribers deduplicate on.
+func (b *Bus) PublishWithID(ctx context.Context, eventID string, e Event) error {
+	if b == nil {
+		return nil
+	}
+	d := Delivery[Event]{ID: eventID, At: b.now(), Event: e}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrClosed
+	}
+	for _, sub := range b.subs {
+		if !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.queue <- d:
+		case <-ctx.Done():
+			return fmt.Errorf("publishing %s to %s: %w", e.EventType(), sub.name, ctx.Err())
+		case <-b.quit:
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+// Close stops accepting events and waits until the subscribers handled
+// the queued ones. When ctx is done first, the handlers are cancelled and
+// what's left is dropped.
+func (b *Bus) Close(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.closeOnce.Do(func() { close(b.quit) })
+
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, sub := range b.subs {
+			close(sub.queue)
+		}
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		b.cancel()
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// deliver hands the queued events to the subscriber one at a time.
+func (b *Bus) deliver(sub *subscriber) {
+	defer b.wg.Done()
+	dropped := 0
+	for d := range sub.queue {
+		if b.ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		b.handle(sub, d)
+	}
+	if dropped > 0 {
+		slog.Error("events dropped, the bus was closed before they were handled",
+			slog.String("subscriber", sub.name), slog.Int("count", dropped))
+	}
+}
+
+// handle calls the handler until it succeeds, waiting longer after every
+// failure.
+func (b *Bus) handle(sub *subscriber, d Delivery[Event]) {
+	backoff := sub.opts.MinBackoff
+	for d.Attempt = 1; ; d.Attempt++ {
+		err := call(b.ctx, sub.handle, d)
+		if err == nil {
+			return
+		}
+
+		attrs := []any{
+			slog.String("subscriber", sub.name),
+			slog.String("event_id", d.ID),
+			slog.String("event_type", d.Event.EventType()),
+			slog.Int("attempt", d.Attempt),
+			slog.String("error", err.Error()),
+		}
+		if sub.opts.MaxAttempts > 0 && d.Attempt >= sub.opts.MaxAttempts {
+			slog.Error("event dropped after too many attempts", attrs...)
+			return
+		}
+		slog.Warn("event handler failed, retrying", append(attrs, slog.Duration("backoff", backoff))...)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			timer.Stop()
+			slog.Error("event dropped, the bus was closed before it was handled", attrs...)
+			return
+		}
+		backoff = min(2*backoff, sub.opts.MaxBackoff)
+	}
+}
+
+// call runs the handler, a panic counts as a failure.
+func call(ctx context.Context, handle Handler[Event], d Delivery[Event]) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handle(ctx, d)
+}
+
+// Log returns a handler logging every event it gets, as an audit trail.
+func Log(logger *slog.Logger) Handler[Event] {
+	return func(ctx context.Context, d Delivery[Event]) error {
+		logger.InfoContext(ctx, "event",
+			slog.String("event_id", d.ID),
+			slog.String("event_type", d.Event.EventType()),
+			slog.Any("event", d.Event),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fast retries right away, so the tests don't wait for the backoff.
+var fast = SubscribeOptions{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// collect returns a handler recording the events it gets, and a function
+// waiting until there are n of them.
+func collect[E Event](t *testing.T) (Handler[E], func(n int) []Delivery[E]) {
+	var mu sync.Mutex
+	var got []Delivery[E]
+	handle := func(ctx context.Context, d Delivery[E]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, d)
+		return nil
+	}
+	wait := func(n int) []Delivery[E] {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			if len(got) >= n {
+				defer mu.Unlock()
+				return append([]Delivery[E](nil), got...)
+			}
+			mu.Unlock()
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d events, but got %d", n, len(got))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return handle, wait
+}
+
+func TestSubscribeByType(t *testing.T) {
+	ctx := context.Background()
+	bus := New(Options{})
+	defer bus.Close(ctx)
+
+	users, waitUsers := collect[UserCreated](t)
+	all, waitAll := collect[Event](t)
+	Subscribe(bus, "users", users, SubscribeOptions{})
+	Subscribe(bus, "all", all, SubscribeOptions{})
+
+	bus.Publish(ctx, OrderCreated{OrderID: "ord_1", UserID: "usr_1", Total: 4999, Currency: "USD"})
+	bus.Publish(ctx, UserCreated{UserID: "usr_2", Name: "Ada"})
+	bus.Publish(ctx, OrderCancelled{OrderID: "ord_1"})
+
+	got := waitUsers(1)
+	if got[0].Event.UserID != "usr_2" || got[0].Attempt != 1 || got[0].ID == "" {
+		t.Errorf("Expected the user event on its first attempt, but got %+v", got[0])
+	}
+	types := []string{"order.created", "user.created", "order.cancelled"}
+	for i, d := range waitAll(3) {
+		if d.Event.EventType() != types[i] {
+			t.Errorf("Expected %s, but got %s", types[i], d.Event.EventType())
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	bus := New(Options{})
+
+	var attempts []int
+	var ids []string
+	Subscribe(bus, "flaky", func(ctx context.Context, d Delivery[UserCreated]) error {
+		attempts = append(attempts, d.Attempt)
+		ids = append(ids, d.ID)
+		switch d.Attempt {
+		case 1:
+			return errors.New("mail server down")
+		case 2:
+			panic("nil mailer")
+		}
+		return nil
+	}, fast)
+
+	bus.Publish(ctx, UserCreated{UserID: "usr_1"})
+	// Close waits until the event is handled
+	if err := bus.Close(ctx); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(attempts) != 3 || attempts[2] != 3 {
+		t.Errorf("Expected the event to be delivered until it succeeds, but got the attempts %v", attempts)
+	}
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("Expected the retries to keep the event id, but got %v", ids)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	bus := New(Options{})
+
+	var mu sync.Mutex
+	got := map[string]int{}
+	opts := fast
+	opts.MaxAttempts = 2
+	Subscribe(bus, "broken", func(ctx context.Context, d Delivery[UserCreated]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got[d.Event.UserID]++
+		if d.Event.UserID == "usr_poison" {
+			return errors.New("always fails")
+		}
+		return nil
+	}, opts)
+
+	bus.Publish(ctx, UserCreated{UserID: "usr_poison"})
+	bus.Publish(ctx, UserCreated{UserID: "usr_1"})
+	bus.Close(ctx)
+	if got["usr_poison"] != 2 || got["usr_1"] != 1 {
+		t.Errorf("Expected the failing event to be given up after 2 attempts, but got %v", got)
+	}
+}
+
+func TestPublishBlocksOnFullBuffer(t *testing.T) {
+	bus := New(Options{})
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+	Subscribe(bus, "slow", func(ctx context.Context, d Delivery[UserCreated]) error {
+		<-release
+		handled <- d.Event.UserID
+		return nil
+	}, SubscribeOptions{Buffer: 1})
+
+	// one in the handler, one in the buffer
+	bus.Publish(context.Background(), UserCreated{UserID: "usr_1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(bus.subs[0].queue) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(context.Background(), UserCreated{UserID: "usr_2"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Publish(ctx, UserCreated{UserID: "usr_3"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the publisher to wait for room until its deadline, but got %v", err)
+	}
+
+	close(release)
+	bus.Close(context.Background())
+	close(handled)
+	var got []string
+	for userID := range handled {
+		got = append(got, userID)
+	}
+	if len(got) != 2 || got[0] != "usr_1" || got[1] != "usr_2" {
+		t.Errorf("Expected the buffered events in order, but got %v", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	bus := New(Options{})
+	Subscribe(bus, "stuck", func(ctx context.Context, d Delivery[UserCreated]) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, SubscribeOptions{})
+	bus.Publish(context.Background(), UserCreated{UserID: "usr_1"})
+	bus.Publish(context.Background(), UserCreated{UserID: "usr_2"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the close to give up on the stuck handler, but got %v", err)
+	}
+	if err := bus.Publish(context.Background(), UserCreated{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected %v, but got %v", ErrClosed, err)
+	}
+	if err := Subscribe(bus, "late", func(context.Context, Delivery[Event]) error { return nil }, SubscribeOptions{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected %v, but got %v", ErrClosed, err)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	if err := bus.Publish(context.Background(), UserCreated{}); err != nil {
+		t.Errorf("Expected a nil bus to drop events, but got %v", err)
+	}
+	if err := bus.Close(context.Background()); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package events is an in-process bus for domain events. The services
+// publish what happened, and other components (notifications, audit,
+// analytics) subscribe without the services knowing about them.
+//
+//	bus := events.New(events.Options{})
+//	events.Subscribe(bus, "welcome-mail", func(ctx context.Context, d events.Delivery[events.UserCreated]) error {
+//		return mailer.Welcome(ctx, d.Event.Email)
+//	}, events.SubscribeOptions{})
+//	bus.Publish(ctx, events.UserCreated{UserID: userID, Email: email})
+//
+// Delivery is at least once: every subscriber has its own buffer and a
+// handler that fails is retried until it succeeds, so it must tolerate
+// getting the same event twice, e.g. by keeping the ids it handled.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event is a domain event. The type names it, e.g. for logs and sinks.
+type Event interface {
+	EventType() string
+}
+
+// UserCreated is published when a user is created.
+type UserCreated struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+func (UserCreated) EventType() string { return "user.created" }
+
+// OrderCreated is published when an order is placed, its stock reserved.
+type OrderCreated struct {
+	OrderID string `json:"order_id"`
+	UserID  string `json:"user_id"`
+	// Total is in minor units of Currency.
+	Total    int64  `json:"total"`
+	Currency string `json:"currency"`
+}
+
+func (OrderCreated) EventType() string { return "order.created" }
+
+// OrderCancelled is published when an order is cancelled, its stock
+// given back.
+type OrderCancelled struct {
+	OrderID string `json:"order_id"`
+	UserID  string `json:"user_id"`
+}
+
+func (OrderCancelled) EventType() string { return "order.cancelled" }
+
+// Unmarshal decodes the JSON of an event of the given type, e.g. one read
+// back from an outbox.
+func Unmarshal(eventType string, b []byte) (Event, error) {
+	var decode func([]byte) (Event, error)
+	switch eventType {
+	case UserCreated{}.EventType():
+		decode = unmarshal[UserCreated]
+	case OrderCreated{}.EventType():
+		decode = unmarshal[OrderCreated]
+	case OrderCancelled{}.EventType():
+		decode = unmarshal[OrderCancelled]
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+	e, err := decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding a %s event: %w", eventType, err)
+	}
+	return e, nil
+}
+
+func unmarshal[E Event](b []byte) (Event, error) {
+	var e E
+	err := json.Unmarshal(b, &e)
+	return e, err
+}
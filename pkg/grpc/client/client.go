@@ -0,0 +1,222 @@
+// Package client builds connections to the gRPC services, balanced across
+// several servers, with retries for idempotent RPCs, optional hedging of
+// reads and default deadlines.
+package client
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// IdempotentMethods are retried on transient failures, repeating them
+// doesn't change the outcome. Creations, deletions and order transitions
+// are not retried: the first attempt may have been applied.
+var IdempotentMethods = []string{
+	"/user.UserService/GetUser",
+	"/user.UserService/UpdateUser",
+	"/user.UserService/ListUsers",
+	"/order.OrderService/GetOrder",
+	"/order.OrderService/ListOrdersByUser",
+	"/order.OrderService/WatchOrders",
+	"/product.ProductService/GetProduct",
+	"/product.ProductService/UpdateProduct",
+	"/product.ProductService/ListProducts",
+}
+
+// HedgedMethods are hedged when Options.Hedging is set.
+var HedgedMethods = []string{
+	"/user.UserService/GetUser",
+	"/order.OrderService/GetOrder",
+}
+
+// RetryPolicy retries an RPC failing with one of the retryable codes,
+// waiting a random backoff between 0 and the current one, which starts at
+// InitialBackoff and grows by BackoffMultiplier up to MaxBackoff. The
+// deadline of the call covers every attempt.
+type RetryPolicy struct {
+	MaxAttempts       int // including the first one, 1 disables retries
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	RetryableCodes    []codes.Code
+}
+
+// DefaultRetryPolicy retries unavailable servers up to 3 times.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       4,
+	InitialBackoff:    100 * time.Millisecond,
+	MaxBackoff:        time.Second,
+	BackoffMultiplier: 2,
+	RetryableCodes:    []codes.Code{codes.Unavailable},
+}
+
+// Options configure a connection.
+type Options struct {
+	// Addresses of the servers, as host:port. Calls are balanced
+	// round-robin across the ones that are up.
+	Addresses []string
+	// TLS enables TLS, the connection is insecure when nil. All the
+	// servers must present a certificate for the same name, the host of
+	// the first address unless TLS.ServerName is set.
+	TLS *tls.Config
+	// Timeout is the deadline of the unary calls made without one, 0 for
+	// none. MethodTimeouts overrides it per full method name.
+	Timeout        time.Duration
+	MethodTimeouts map[string]time.Duration
+	// Retry applies to IdempotentMethods, DefaultRetryPolicy when zero.
+	Retry RetryPolicy
+	// Hedging applies to HedgedMethods instead of Retry, nil disables it.
+	Hedging *HedgingPolicy
+	// DialOptions are added after the ones built from the fields above.
+	DialOptions []grpc.DialOption
+}
+
+// New returns a connection to the servers. Like grpc.NewClient, it
+// doesn't connect until the first call.
+func New(opts Options) (*grpc.ClientConn, error) {
+	if len(opts.Addresses) == 0 {
+		return nil, errors.New("client: no address")
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry = DefaultRetryPolicy
+	}
+	if opts.Hedging != nil && opts.Hedging.MaxAttempts < 1 {
+		return nil, errors.New("client: hedging needs at least one attempt")
+	}
+
+	serviceConfig, err := ServiceConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The addresses are fixed, a manual resolver hands them all to the
+	// round-robin balancer. The target only sets the default authority.
+	r := manual.NewBuilderWithScheme("static")
+	state := resolver.State{}
+	for _, addr := range opts.Addresses {
+		state.Endpoints = append(state.Endpoints, resolver.Endpoint{Addresses: []resolver.Address{{Addr: addr}}})
+	}
+	r.InitialState(state)
+
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+
+	unary := []grpc.UnaryClientInterceptor{defaultDeadline(opts.Timeout, opts.MethodTimeouts)}
+	if opts.Hedging != nil {
+		unary = append(unary, hedge(*opts.Hedging, HedgedMethods))
+	}
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(unary...),
+	}, opts.DialOptions...)
+	return grpc.NewClient("static:///"+opts.Addresses[0], dialOpts...)
+}
+
+// ServiceConfig returns the JSON service config of a connection: the
+// round-robin balancer and the retry policy of the idempotent methods.
+// Hedged methods are left out, grpc-go doesn't implement hedging so it is
+// done by an interceptor.
+func ServiceConfig(opts Options) (string, error) {
+	type name struct {
+		Service string `json:"service"`
+		Method  string `json:"method,omitempty"`
+	}
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []name       `json:"name"`
+		RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+	}
+	type throttling struct {
+		MaxTokens  int     `json:"maxTokens"`
+		TokenRatio float64 `json:"tokenRatio"`
+	}
+	config := struct {
+		LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+		MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+		RetryThrottling     *throttling           `json:"retryThrottling,omitempty"`
+	}{
+		LoadBalancingConfig: []map[string]struct{}{{"round_robin": {}}},
+	}
+
+	retry := opts.Retry
+	if retry.MaxAttempts > 1 {
+		if retry.InitialBackoff <= 0 || retry.MaxBackoff <= 0 || retry.BackoffMultiplier <= 0 || len(retry.RetryableCodes) == 0 {
+			return "", errors.New("client: the retry policy needs backoffs, a multiplier and retryable codes")
+		}
+		policy := &retryPolicy{
+			MaxAttempts:       retry.MaxAttempts,
+			InitialBackoff:    seconds(retry.InitialBackoff),
+			MaxBackoff:        seconds(retry.MaxBackoff),
+			BackoffMultiplier: retry.BackoffMultiplier,
+		}
+		for _, code := range retry.RetryableCodes {
+			policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, codeName(code))
+		}
+
+		hedged := opts.Hedging != nil
+		var names []name
+		for _, method := range IdempotentMethods {
+			if hedged && slices.Contains(HedgedMethods, method) {
+				continue
+			}
+			service, method := splitMethod(method)
+			names = append(names, name{Service: service, Method: method})
+		}
+		config.MethodConfig = append(config.MethodConfig, methodConfig{Name: names, RetryPolicy: policy})
+		// a burst of failures pauses the retries until successes make up for it
+		config.RetryThrottling = &throttling{MaxTokens: 10, TokenRatio: 0.1}
+	}
+
+	b, err := json.Marshal(config)
+	return string(b), err
+}
+
+// seconds formats d the way service configs expect durations, "1.5s".
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// codeName returns the canonical name of code, "DEADLINE_EXCEEDED" for
+// codes.DeadlineExceeded.
+func codeName(code codes.Code) string {
+	var b strings.Builder
+	prev := 'A'
+	for _, r := range code.String() {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return b.String()
+}
+
+// splitMethod splits "/package.Service/Method" into its service and method.
+func splitMethod(fullMethod string) (string, string) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service, method
+}
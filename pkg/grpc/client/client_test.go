@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	userpb "go-learning/pkg/grpc/user"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// userServer answers GetUser with its name after delay, failing the first
+// failures calls with Unavailable.
+type userServer struct {
+	userpb.UnimplementedUserServiceServer
+	name     string
+	delay    time.Duration
+	failures int32
+	calls    atomic.Int32
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.GetUserReply, error) {
+	if s.calls.Add(1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	select {
+	case <-time.After(s.delay):
+		return &userpb.GetUserReply{Id: req.GetId(), Name: s.name}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (s *userServer) CreateUser(context.Context, *userpb.CreateUserRequest) (*userpb.CreateUserReply, error) {
+	s.calls.Add(1)
+	return nil, status.Error(codes.Unavailable, "try again")
+}
+
+func serve(t *testing.T, s *userServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	userpb.RegisterUserServiceServer(server, s)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func dial(t *testing.T, opts Options) userpb.UserServiceClient {
+	t.Helper()
+	conn, err := New(opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return userpb.NewUserServiceClient(conn)
+}
+
+func TestRoundRobin(t *testing.T) {
+	a, b := &userServer{name: "a"}, &userServer{name: "b"}
+	client := dial(t, Options{Addresses: []string{serve(t, a), serve(t, b)}})
+
+	// calls only go to the servers already connected, give both some time
+	for i := 0; i < 100 && (a.calls.Load() == 0 || b.calls.Load() == 0); i++ {
+		if _, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: "u1"}); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a.calls.Load() == 0 || b.calls.Load() == 0 {
+		t.Errorf("Expected calls on both servers, but got %d and %d", a.calls.Load(), b.calls.Load())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := &userServer{name: "a", failures: 2}
+	client := dial(t, Options{Addresses: []string{serve(t, s)}, Retry: RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond,
+		BackoffMultiplier: 1,
+		RetryableCodes:    []codes.Code{codes.Unavailable},
+	}})
+
+	if _, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: "u1"}); err != nil {
+		t.Fatalf("Expected the retries to succeed, but got %v", err)
+	}
+	if got := s.calls.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, but got %d", got)
+	}
+
+	// creations are not idempotent
+	s.calls.Store(0)
+	if _, err := client.CreateUser(context.Background(), &userpb.CreateUserRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable, but got %v", err)
+	}
+	if got := s.calls.Load(); got != 1 {
+		t.Errorf("Expected a single attempt, but got %d", got)
+	}
+}
+
+func TestHedging(t *testing.T) {
+	slow, fast := &userServer{name: "slow", delay: time.Second}, &userServer{name: "fast"}
+	client := dial(t, Options{
+		Addresses: []string{serve(t, slow), serve(t, fast)},
+		Hedging:   &HedgingPolicy{MaxAttempts: 2, Delay: 20 * time.Millisecond},
+	})
+	// wait for both servers to be connected, CreateUser isn't hedged
+	for slow.calls.Load() == 0 || fast.calls.Load() == 0 {
+		client.CreateUser(context.Background(), &userpb.CreateUserRequest{})
+	}
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		reply, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: "u1"})
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		if reply.GetName() != "fast" || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("Expected the fast server to answer quickly, but got %q after %v", reply.GetName(), time.Since(start))
+		}
+	}
+}
+
+func TestDefaultDeadline(t *testing.T) {
+	s := &userServer{name: "a", delay: 100 * time.Millisecond}
+	client := dial(t, Options{Addresses: []string{serve(t, s)}, Timeout: 10 * time.Millisecond})
+
+	if _, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: "u1"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, but got %v", err)
+	}
+
+	// a deadline set by the caller wins
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: "u1"}); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+}
+
+func TestServiceConfig(t *testing.T) {
+	config, err := ServiceConfig(Options{Retry: DefaultRetryPolicy, Hedging: &HedgingPolicy{MaxAttempts: 2}})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var parsed struct {
+		MethodConfig []struct {
+			Name []struct {
+				Service, Method string
+			}
+			RetryPolicy struct {
+				RetryableStatusCodes []string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		t.Fatalf("Expected valid JSON, but got %v", err)
+	}
+	for _, name := range parsed.MethodConfig[0].Name {
+		if name.Method == "GetUser" || name.Method == "GetOrder" {
+			t.Errorf("Expected hedged methods to be left out of the retries, but got %s", name.Method)
+		}
+	}
+	if got := parsed.MethodConfig[0].RetryPolicy.RetryableStatusCodes; len(got) != 1 || got[0] != "UNAVAILABLE" {
+		t.Errorf("Expected [UNAVAILABLE], but got %v", got)
+	}
+	if got := codeName(codes.DeadlineExceeded); got != "DEADLINE_EXCEEDED" {
+		t.Errorf("Expected DEADLINE_EXCEEDED, but got %s", got)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HedgingPolicy sends the same RPC again when the previous attempt hasn't
+// answered after Delay, up to MaxAttempts in total, and keeps the first
+// reply. A failure with one of the non fatal codes starts the next attempt
+// right away, any other failure ends the call.
+//
+// Attempts run concurrently, so call options writing to the caller's
+// variables, such as grpc.Header, must not be used with hedged methods.
+type HedgingPolicy struct {
+	MaxAttempts   int
+	Delay         time.Duration
+	NonFatalCodes []codes.Code // codes.Unavailable when empty
+}
+
+// defaultDeadline gives unary calls without a deadline the timeout of their
+// method, or the default one. Streams are long-lived and left alone.
+func defaultDeadline(timeout time.Duration, methodTimeouts map[string]time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			d, ok := methodTimeouts[method]
+			if !ok {
+				d = timeout
+			}
+			if d > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// hedge hedges the given methods, each attempt goes through the balancer
+// so they usually reach different servers.
+func hedge(policy HedgingPolicy, methods []string) grpc.UnaryClientInterceptor {
+	nonFatal := policy.NonFatalCodes
+	if len(nonFatal) == 0 {
+		nonFatal = []codes.Code{codes.Unavailable}
+	}
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		out, ok := reply.(proto.Message)
+		if !ok || policy.MaxAttempts < 2 || !slices.Contains(methods, method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		// the losing attempts are cancelled once the call returns
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			reply proto.Message
+			err   error
+		}
+		results := make(chan result, policy.MaxAttempts)
+		started, pending := 0, 0
+		start := func() {
+			started++
+			pending++
+			go func() {
+				// every attempt needs its own reply, the winner's is copied
+				r := out.ProtoReflect().New().Interface()
+				results <- result{r, invoker(ctx, method, req, r, cc, opts...)}
+			}()
+		}
+
+		start()
+		timer := time.NewTimer(policy.Delay)
+		defer timer.Stop()
+
+		var err error
+		for pending > 0 {
+			select {
+			case <-timer.C:
+				if started < policy.MaxAttempts {
+					start()
+					timer.Reset(policy.Delay)
+				}
+			case r := <-results:
+				pending--
+				if r.err == nil {
+					proto.Merge(out, r.reply)
+					return nil
+				}
+				err = r.err
+				if !slices.Contains(nonFatal, status.Code(r.err)) {
+					return err
+				}
+				if started < policy.MaxAttempts {
+					start()
+					timer.Reset(policy.Delay)
+				}
+			}
+		}
+		return err
+	}
+}
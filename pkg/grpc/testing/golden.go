@@ -0,0 +1,76 @@
+package grpctesting
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the replies got")
+
+// Golden compares m to the golden file testdata/<test name>.golden of the
+// package under test. With -update, the file is written instead:
+//
+//	go test ./... -run TestUsers -update
+func Golden(t testing.TB, m proto.Message) {
+	t.Helper()
+	got, err := marshal(m)
+	if err != nil {
+		t.Fatalf("Expected the reply to marshal, but got %v", err)
+	}
+
+	path := filepath.Join("testdata", filepath.FromSlash(t.Name())+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected the reply in %s, but got\n%s", path, got)
+	}
+}
+
+// GoldenReply compares the outcome of an RPC to its golden file: the
+// reply, or the status with its details when it failed.
+func GoldenReply(t testing.TB, reply proto.Message, err error) {
+	t.Helper()
+	if err != nil {
+		Golden(t, status.Convert(err).Proto())
+		return
+	}
+	Golden(t, reply)
+}
+
+// marshal renders a message as indented JSON. protojson output is
+// deliberately unstable, so it's reformatted before being compared.
+func marshal(m proto.Message) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var compact, out bytes.Buffer
+	if err := json.Compact(&compact, b); err != nil {
+		return nil, err
+	}
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,272 @@
+package grpctesting
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"go-learning/internal/orders"
+	common "go-learning/pkg/grpc/common"
+	orderpb "go-learning/pkg/grpc/order"
+	productpb "go-learning/pkg/grpc/product"
+	userpb "go-learning/pkg/grpc/user"
+	"go-learning/pkg/id"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// fixture is what seed creates before each case.
+type fixture struct {
+	user, product, order string
+}
+
+// seed creates a user, a product with 10 in stock and an order of 2, a
+// second apart.
+func seed(t *testing.T, h *Harness) fixture {
+	t.Helper()
+	ctx := context.Background()
+	user, err := h.Users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	h.Clock.Advance(time.Second)
+	product, err := h.Products.CreateProduct(ctx, &productpb.CreateProductRequest{
+		Sku: "KB-001", Name: "Keyboard", Price: &common.Money{Amount: 4999, Currency: "USD"}, Stock: 10,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	h.Clock.Advance(time.Second)
+	order, err := h.Orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+		UserId: user.GetId(),
+		Items:  []*orderpb.OrderItem{{ProductId: product.GetId(), Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	h.Clock.Advance(time.Second)
+	return fixture{user: user.GetId(), product: product.GetId(), order: order.GetId()}
+}
+
+// rpcCase calls one RPC on a freshly seeded harness. The reply, or the
+// status when it fails, is compared to testdata/<test>/<case>.golden.
+type rpcCase struct {
+	name string
+	call func(ctx context.Context, h *Harness, f fixture) (proto.Message, error)
+	code codes.Code
+}
+
+func run(t *testing.T, opts Options, cases []rpcCase) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := New(t, opts)
+			f := seed(t, h)
+			reply, err := tc.call(context.Background(), h, f)
+			if status.Code(err) != tc.code {
+				t.Fatalf("Expected %v, but got %v", tc.code, err)
+			}
+			GoldenReply(t, reply, err)
+		})
+	}
+}
+
+// missing returns a well formed id nothing was created with.
+func missing(prefix id.Prefix) string {
+	return id.NewGenerator(func() time.Time { return Epoch.Add(-time.Hour) }, rand.NewChaCha8([32]byte{1})).New(prefix)
+}
+
+func TestUserService(t *testing.T) {
+	run(t, Options{DedupWindow: time.Minute}, []rpcCase{
+		{name: "GetUser", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.GetUser(ctx, &userpb.GetUserRequest{Id: f.user})
+		}},
+		{name: "GetUser not found", code: codes.NotFound, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.GetUser(ctx, &userpb.GetUserRequest{Id: "usr_00000000000000000000000000"})
+		}},
+		{name: "GetUser malformed id", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.GetUser(ctx, &userpb.GetUserRequest{Id: "42"})
+		}},
+		{name: "CreateUser", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Grace", Email: "grace@example.com"})
+		}},
+		{name: "CreateUser retried", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			req := &userpb.CreateUserRequest{Name: "Grace", Email: "grace@example.com", RequestId: "retry-1"}
+			h.Users.CreateUser(ctx, req)
+			return h.Users.CreateUser(ctx, req)
+		}},
+		{name: "CreateUser request_id reused", code: codes.AlreadyExists, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			h.Users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Grace", Email: "grace@example.com", RequestId: "retry-1"})
+			return h.Users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Linus", Email: "linus@example.com", RequestId: "retry-1"})
+		}},
+		{name: "UpdateUser", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.UpdateUser(ctx, &userpb.UpdateUserRequest{
+				Id: f.user, Name: "Ada Lovelace", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+			})
+		}},
+		{name: "UpdateUser unknown path", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.UpdateUser(ctx, &userpb.UpdateUserRequest{
+				Id: f.user, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"id"}},
+			})
+		}},
+		{name: "DeleteUser", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: f.user})
+		}},
+		{name: "DeleteUser not found", code: codes.NotFound, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: missing(id.User)})
+		}},
+		{name: "ListUsers", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			h.Users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Grace", Email: "grace@example.com"})
+			return h.Users.ListUsers(ctx, &userpb.ListUsersRequest{PageSize: 1})
+		}},
+		{name: "ListUsers filtered", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			h.Users.CreateUser(ctx, &userpb.CreateUserRequest{Name: "Grace", Email: "grace@example.com"})
+			return h.Users.ListUsers(ctx, &userpb.ListUsersRequest{NameContains: "GRA"})
+		}},
+		{name: "ListUsers negative page size", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Users.ListUsers(ctx, &userpb.ListUsersRequest{PageSize: -1})
+		}},
+	})
+}
+
+func TestProductService(t *testing.T) {
+	run(t, Options{}, []rpcCase{
+		{name: "GetProduct", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.GetProduct(ctx, &productpb.GetProductRequest{Id: f.product})
+		}},
+		{name: "GetProduct not found", code: codes.NotFound, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.GetProduct(ctx, &productpb.GetProductRequest{Id: missing(id.Product)})
+		}},
+		{name: "CreateProduct", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.CreateProduct(ctx, &productpb.CreateProductRequest{
+				Sku: "MS-001", Name: "Mouse", Price: &common.Money{Amount: 1999, Currency: "USD"}, Stock: 5,
+			})
+		}},
+		{name: "CreateProduct duplicate sku", code: codes.AlreadyExists, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.CreateProduct(ctx, &productpb.CreateProductRequest{
+				Sku: "KB-001", Name: "Keyboard", Price: &common.Money{Amount: 4999, Currency: "USD"},
+			})
+		}},
+		{name: "CreateProduct invalid", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.CreateProduct(ctx, &productpb.CreateProductRequest{Price: &common.Money{Amount: -1, Currency: "usd"}, Stock: -1})
+		}},
+		{name: "UpdateProduct", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.UpdateProduct(ctx, &productpb.UpdateProductRequest{
+				Id: f.product, Stock: 100, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"stock"}},
+			})
+		}},
+		{name: "UpdateProduct unknown path", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.UpdateProduct(ctx, &productpb.UpdateProductRequest{
+				Id: f.product, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"color"}},
+			})
+		}},
+		{name: "DeleteProduct", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.DeleteProduct(ctx, &productpb.DeleteProductRequest{Id: f.product})
+		}},
+		{name: "DeleteProduct not found", code: codes.NotFound, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.DeleteProduct(ctx, &productpb.DeleteProductRequest{Id: missing(id.Product)})
+		}},
+		{name: "ListProducts", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.ListProducts(ctx, &productpb.ListProductsRequest{})
+		}},
+		{name: "ListProducts bad token", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Products.ListProducts(ctx, &productpb.ListProductsRequest{PageToken: "!"})
+		}},
+	})
+}
+
+func TestOrderService(t *testing.T) {
+	run(t, Options{Pricing: orders.Pricing{TaxBasisPoints: 1600}}, []rpcCase{
+		{name: "GetOrder", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.GetOrder(ctx, &orderpb.GetOrderRequest{Id: f.order})
+		}},
+		{name: "GetOrder not found", code: codes.NotFound, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.GetOrder(ctx, &orderpb.GetOrderRequest{Id: missing(id.Order)})
+		}},
+		{name: "CreateOrder", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: f.user, ProductIds: []string{f.product}})
+		}},
+		{name: "CreateOrder unknown user", code: codes.NotFound, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: missing(id.User), ProductIds: []string{f.product}})
+		}},
+		{name: "CreateOrder out of stock", code: codes.FailedPrecondition, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{
+				UserId: f.user, Items: []*orderpb.OrderItem{{ProductId: f.product, Quantity: 9}},
+			})
+		}},
+		{name: "CreateOrder invalid", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: f.user, ProductIds: []string{f.product, f.product, ""}})
+		}},
+		{name: "CancelOrder", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: f.order})
+		}},
+		{name: "CancelOrder paid", code: codes.FailedPrecondition, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order})
+			return h.Orders.CancelOrder(ctx, &orderpb.CancelOrderRequest{Id: f.order})
+		}},
+		{name: "AdvanceOrder", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order})
+		}},
+		{name: "AdvanceOrder to target", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order})
+			h.Clock.Advance(time.Hour)
+			return h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order, TargetState: orderpb.OrderState_ORDER_STATE_SHIPPED})
+		}},
+		{name: "AdvanceOrder skipping a state", code: codes.FailedPrecondition, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order, TargetState: orderpb.OrderState_ORDER_STATE_DELIVERED})
+		}},
+		{name: "ListOrdersByUser", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			h.Orders.CreateOrder(ctx, &orderpb.CreateOrderRequest{UserId: f.user, ProductIds: []string{f.product}})
+			return h.Orders.ListOrdersByUser(ctx, &orderpb.ListOrdersByUserRequest{UserId: f.user})
+		}},
+		{name: "ListOrdersByUser malformed id", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			return h.Orders.ListOrdersByUser(ctx, &orderpb.ListOrdersByUserRequest{UserId: f.order})
+		}},
+		{name: "WatchOrders", call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			// resuming from 0 replays the order created by seed
+			stream, err := h.Orders.WatchOrders(ctx, &orderpb.WatchOrdersRequest{OrderId: f.order, AfterSequence: proto.Uint64(0)})
+			if err != nil {
+				return nil, err
+			}
+			return stream.Recv()
+		}},
+		{name: "WatchOrders unknown sequence", code: codes.InvalidArgument, call: func(ctx context.Context, h *Harness, f fixture) (proto.Message, error) {
+			stream, err := h.Orders.WatchOrders(ctx, &orderpb.WatchOrdersRequest{AfterSequence: proto.Uint64(42)})
+			if err != nil {
+				return nil, err
+			}
+			return stream.Recv()
+		}},
+	})
+}
+
+// TestWatchOrdersLive follows an order through the stream while it
+// changes. Resuming after the order was placed means no change is missed
+// before the watch is registered.
+func TestWatchOrdersLive(t *testing.T) {
+	h := New(t, Options{})
+	f := seed(t, h)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := h.Orders.WatchOrders(ctx, &orderpb.WatchOrdersRequest{UserId: f.user, AfterSequence: proto.Uint64(1)})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order})
+	h.Clock.Advance(time.Minute)
+	h.Orders.AdvanceOrder(ctx, &orderpb.AdvanceOrderRequest{Id: f.order})
+
+	var reply orderpb.ListOrdersByUserReply
+	for range 2 {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Expected two events, but got %v", err)
+		}
+		reply.Orders = append(reply.Orders, event.GetOrder())
+	}
+	Golden(t, &reply)
+}
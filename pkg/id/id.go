@@ -0,0 +1,200 @@
+// Package id generates the ids of the resources: a type prefix and a ULID,
+// such as "usr_01J9ZQ4X7N3V8R2K5M6P0T1W4Y". The ULID starts with the
+// creation time in milliseconds, so ids sort by creation time, both as
+// strings and as bytes, and they don't leak how many resources exist.
+package id
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix tells the type of resource an id belongs to.
+type Prefix string
+
+const (
+	User    Prefix = "usr"
+	Order   Prefix = "ord"
+	Product Prefix = "prd"
+	Event   Prefix = "evt"
+)
+
+var (
+	ErrMalformed   = errors.New("malformed id")
+	ErrWrongPrefix = errors.New("wrong id prefix")
+)
+
+const (
+	separator = "_"
+	// encodedLen is the length of a ULID in Crockford's base32: 128 bits
+	// in 26 characters, the first one only holding 3 bits.
+	encodedLen = 26
+	alphabet   = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// ID is a parsed id.
+type ID struct {
+	Prefix Prefix
+	ULID   [16]byte // 48 bits of Unix milliseconds, then 80 random bits
+}
+
+// Time returns the creation time of the id, to the millisecond.
+func (id ID) Time() time.Time {
+	var ms int64
+	for _, b := range id.ULID[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	return time.UnixMilli(ms)
+}
+
+func (id ID) String() string {
+	return string(id.Prefix) + separator + encode(id.ULID)
+}
+
+// Parse parses an id of any type. Only the canonical, upper case, ULIDs
+// are accepted, so an id has a single spelling.
+func Parse(s string) (ID, error) {
+	prefix, ulid, ok := strings.Cut(s, separator)
+	if !ok || prefix == "" {
+		return ID{}, fmt.Errorf("%w: %q has no type prefix", ErrMalformed, s)
+	}
+	b, err := decode(ulid)
+	if err != nil {
+		return ID{}, fmt.Errorf("%w: %q: %v", ErrMalformed, s, err)
+	}
+	return ID{Prefix: Prefix(prefix), ULID: b}, nil
+}
+
+// Validate checks that s is a well formed id of the given type.
+func Validate(prefix Prefix, s string) error {
+	id, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	if id.Prefix != prefix {
+		return fmt.Errorf("%w: %q is not a %s_ id", ErrWrongPrefix, s, prefix)
+	}
+	return nil
+}
+
+// Generator mints ids, monotonically within a millisecond: ids created in
+// the same millisecond increment the random part of the previous one, so
+// they still sort in creation order. It is safe for concurrent use.
+type Generator struct {
+	now     func() time.Time
+	entropy io.Reader
+
+	mu     sync.Mutex
+	lastMS int64
+	last   [10]byte // random part of the last id
+}
+
+// NewGenerator returns a generator reading the time from now and random
+// bytes from entropy, time.Now and crypto/rand when nil.
+func NewGenerator(now func() time.Time, entropy io.Reader) *Generator {
+	if now == nil {
+		now = time.Now
+	}
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	return &Generator{now: now, entropy: entropy}
+}
+
+// Default is the generator used by New.
+var Default = NewGenerator(nil, nil)
+
+// New returns a new id of the given type from the Default generator.
+func New(prefix Prefix) string {
+	return Default.New(prefix)
+}
+
+// New returns a new id of the given type.
+func (g *Generator) New(prefix Prefix) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().UnixMilli()
+	// a clock going backwards keeps the last millisecond, ids never go back
+	if ms <= g.lastMS && g.increment() {
+		ms = g.lastMS
+	} else {
+		if ms <= g.lastMS {
+			// 2^80 ids in a millisecond, borrow the next one
+			ms = g.lastMS + 1
+		}
+		if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+			panic(fmt.Sprintf("id: reading random bytes: %v", err))
+		}
+		g.lastMS = ms
+	}
+
+	var ulid [16]byte
+	for i := 5; i >= 0; i-- {
+		ulid[i] = byte(ms)
+		ms >>= 8
+	}
+	copy(ulid[6:], g.last[:])
+	return ID{Prefix: prefix, ULID: ulid}.String()
+}
+
+// increment adds one to the random part, it returns false on overflow.
+func (g *Generator) increment() bool {
+	for i := len(g.last) - 1; i >= 0; i-- {
+		g.last[i]++
+		if g.last[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the 128 bits as 26 base32 characters, 5 bits each, with
+// 2 bits of padding in front.
+func encode(b [16]byte) string {
+	var out [encodedLen]byte
+	// big-endian 128 bit number, as two halves
+	hi := uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 |
+		uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7])
+	lo := uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 |
+		uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15])
+	for i := encodedLen - 1; i >= 0; i-- {
+		out[i] = alphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+func decode(s string) ([16]byte, error) {
+	var b [16]byte
+	if len(s) != encodedLen {
+		return b, fmt.Errorf("expected %d characters, got %d", encodedLen, len(s))
+	}
+	if s[0] > '7' {
+		// the first character only holds the top 3 bits
+		return b, errors.New("overflows 128 bits")
+	}
+
+	var hi, lo uint64
+	for i := 0; i < encodedLen; i++ {
+		v := strings.IndexByte(alphabet, s[i])
+		if v < 0 {
+			return b, fmt.Errorf("invalid character %q", s[i])
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	for i := 7; i >= 0; i-- {
+		b[i] = byte(hi)
+		b[i+8] = byte(lo)
+		hi >>= 8
+		lo >>= 8
+	}
+	return b, nil
+}
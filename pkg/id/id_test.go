@@ -0,0 +1,111 @@
+package id
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_123)
+	g := NewGenerator(func() time.Time { return now }, nil)
+
+	s := g.New(User)
+	if !strings.HasPrefix(s, "usr_") || len(s) != len("usr_")+encodedLen {
+		t.Fatalf("Expected a usr_ id, but got %q", s)
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if parsed.Prefix != User || !parsed.Time().Equal(now) || parsed.String() != s {
+		t.Errorf("Expected %s created at %v, but got %+v", s, now, parsed)
+	}
+}
+
+func TestMonotonic(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	g := NewGenerator(func() time.Time { return now }, nil)
+
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, g.New(Order))
+		if i == 500 {
+			// the clock going backwards doesn't break the order
+			now = now.Add(-time.Second)
+		}
+	}
+	if !slices.IsSorted(ids) {
+		t.Error("Expected ids created in the same millisecond to be sorted")
+	}
+	if len(slices.Compact(slices.Clone(ids))) != len(ids) {
+		t.Error("Expected unique ids")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	// the first random part is the maximum, the next id borrows a millisecond
+	g := NewGenerator(func() time.Time { return now }, bytes.NewReader(bytes.Repeat([]byte{0xff}, 20)))
+
+	first, _ := Parse(g.New(Order))
+	second, _ := Parse(g.New(Order))
+	if !second.Time().Equal(now.Add(time.Millisecond)) || bytes.Compare(first.ULID[:], second.ULID[:]) >= 0 {
+		t.Errorf("Expected the next millisecond, but got %v", second.Time())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	g := NewGenerator(nil, nil)
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s := g.New(User)
+				mu.Lock()
+				if seen[s] {
+					t.Errorf("Expected unique ids, but %s was generated twice", s)
+				}
+				seen[s] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestValidate(t *testing.T) {
+	valid := New(User)
+	tests := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"other type", New(Order), ErrWrongPrefix},
+		{"no prefix", strings.TrimPrefix(valid, "usr_"), ErrMalformed},
+		{"legacy", "u1", ErrMalformed},
+		{"lower case", strings.ToLower(valid), ErrMalformed},
+		{"too short", valid[:len(valid)-1], ErrMalformed},
+		{"excluded letter", valid[:len(valid)-1] + "U", ErrMalformed},
+		{"overflow", "usr_8" + valid[5:], ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(User, tt.id); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
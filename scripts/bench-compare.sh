@@ -0,0 +1,86 @@
+#!/usr/bin/env bash
+# Runs the gRPC services benchmarks of the working tree against two
+# revisions and prints the median ns/op of each as a markdown table, the
+# one of docs/benchmarks.md.
+#
+#   scripts/bench-compare.sh base [head]
+#
+# base is any revision git knows, a tag or a commit, and head defaults to
+# HEAD. BENCH, COUNT, BENCHTIME and CPU override the go test flags.
+set -euo pipefail
+
+if [ $# -lt 1 ]; then
+	echo "usage: $0 base [head]" >&2
+	exit 2
+fi
+base=$1
+head=${2:-HEAD}
+bench=${BENCH:-.}
+count=${COUNT:-10}
+benchtime=${BENCHTIME:-1s}
+cpu=${CPU:-1,8}
+
+root=$(git rev-parse --show-toplevel)
+work=$(mktemp -d)
+trap 'git -C "$root" worktree remove --force "$work/base" 2>/dev/null || true
+      git -C "$root" worktree remove --force "$work/head" 2>/dev/null || true
+      rm -rf "$work"' EXIT
+
+# builds the benchmarks of the working tree against a revision
+build() {
+	local name=$1 rev=$2 dir=$work/$1
+	git -C "$root" worktree add --quiet --detach "$dir" "$rev"
+	cp "$root/internal/services/bench_test.go" "$root/internal/services/bench_servers_test.go" "$dir/internal/services/"
+	if ! grep -q 'func NewStores' "$dir/internal/services/"*.go; then
+		# before the per-store locks, the servers shared package-level state
+		cat >"$dir/internal/services/bench_servers_test.go" <<'GO'
+package services
+
+import "go-learning/internal/orders"
+
+func newBenchServers() (*UserServer, *OrderServer, *ProductServer) {
+	return NewUserServer(0), NewOrderServer(orders.Pricing{}, 0), NewProductServer()
+}
+GO
+	fi
+	(cd "$dir" && go test -c -o "$work/$name.test" ./internal/services)
+}
+
+build base "$base"
+build head "$head"
+
+# the runs alternate, so a machine getting slower or faster over time
+# affects both sides alike
+for i in $(seq "$count"); do
+	echo "run $i of $count..." >&2
+	for name in base head; do
+		"$work/$name.test" -test.run '^$' -test.bench "$bench" -test.benchtime "$benchtime" -test.cpu "$cpu" >>"$work/$name.txt"
+	done
+done
+
+# median ns/op of every benchmark, in the order they ran
+medians() {
+	awk '/^Benchmark/ {
+		name = substr($1, 10)
+		if (!(name in n)) order[++names] = name
+		v[name, ++n[name]] = $3
+	}
+	END {
+		for (i = 1; i <= names; i++) {
+			name = order[i]
+			m = n[name]
+			for (j = 1; j <= m; j++) s[j] = v[name, j]
+			for (j = 2; j <= m; j++) for (k = j; k > 1 && s[k-1] > s[k]; k--) { t = s[k]; s[k] = s[k-1]; s[k-1] = t }
+			median = m % 2 ? s[(m+1)/2] : (s[m/2] + s[m/2+1]) / 2
+			printf "%s %d\n", name, median
+		}
+	}' "$1"
+}
+
+printf '| %-16s | %12s | %12s |\n' Benchmark "$base" "$head"
+printf '|%s|%s|%s|\n' ------------------ -------------: -------------:
+join <(medians "$work/base.txt" | sort) <(medians "$work/head.txt" | sort) |
+	sort -k1,1V |
+	while read -r name before after; do
+		printf '| %-16s | %12s | %12s |\n' "$name" "$before" "$after"
+	done